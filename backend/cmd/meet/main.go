@@ -1,41 +1,134 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/Coderovshik/meet/internal/api"
 	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/config"
+	"github.com/Coderovshik/meet/internal/ice"
+	"github.com/Coderovshik/meet/internal/logging"
+	"github.com/Coderovshik/meet/internal/origin"
+	"github.com/Coderovshik/meet/internal/recording"
 	"github.com/Coderovshik/meet/internal/signaling"
+	"github.com/Coderovshik/meet/internal/turnserver"
 
 	"github.com/redis/go-redis/v9"
 )
 
 func main() {
-	redis_host := os.Getenv("REDIS_HOST")
-	if redis_host == "" {
-		redis_host = "localhost"
+	if err := run(); err != nil {
+		log.Fatal(err)
 	}
-	redisClient := redis.NewClient(&redis.Options{
-		// Addr: fmt.Sprintf("%s:41163", redis_host),
-		Addr: fmt.Sprintf("%s:6379", redis_host),
-	})
+
+	log.Printf("Server stopped")
+}
+
+// run запускает сервер и возвращает ошибку, не завершая процесс, чтобы
+// отложенные закрытия TURN-сервера и Redis выполнились в любом случае
+func run() error {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		return fmt.Errorf("Ошибка в конфигурации:\n%w", err)
+	}
+	logLevel, _ := logging.ParseLevel(cfg.LogLevel)
+	logging.SetLevel(logLevel)
+	for _, warning := range cfg.Warnings {
+		log.Printf("ВНИМАНИЕ: %s", warning)
+	}
+
+	redisOptions := &redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	}
+	if cfg.Redis.TLS {
+		host, _, _ := net.SplitHostPort(cfg.Redis.Addr)
+		redisOptions.TLSConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	}
+	redisClient := redis.NewClient(redisOptions)
+	defer func() {
+		if err := redisClient.Close(); err != nil {
+			logging.Warnf("Ошибка при закрытии соединения с Redis: %v", err)
+		}
+	}()
+
 	userStore := auth.NewUserStore(redisClient)
+	sessionStore := auth.NewSessionStore(redisClient, cfg.SessionTTL)
+
+	// Встроенный TURN-сервер
+	if cfg.TURN.Enabled {
+		turnServer, err := turnserver.Start(cfg.TURN, cfg.ICE.TURNSecret, sessionStore)
+		if err != nil {
+			return fmt.Errorf("Ошибка при запуске TURN-сервера: %w", err)
+		}
+		defer turnServer.Close()
+		log.Printf("TURN server running on %s (udp %d, tcp %d)", cfg.TURN.PublicIP, cfg.TURN.UDPPort, cfg.TURN.TCPPort)
+	}
+	iceServers := ice.NewProvider(cfg.ICE)
 	logStore := auth.NewLogStore(redisClient)
+	roomStore := auth.NewRoomStore(redisClient)
+	inviteStore := auth.NewInviteStore(redisClient, []byte(cfg.InviteSecret))
+	chatStore := auth.NewChatStore(redisClient)
+	recordingStore, err := recording.NewStore(cfg.Recording)
+	if err != nil {
+		return fmt.Errorf("Ошибка при создании хранилища записей: %w", err)
+	}
+	recordingIndex := auth.NewRecordingIndex(redisClient)
+	rooms := signaling.NewRoomRegistry(cfg.Recording, recordingStore, recordingIndex)
+	origins, err := origin.New(cfg.AllowedOrigins)
+	if err != nil {
+		return fmt.Errorf("Ошибка в списке разрешенных источников: %w", err)
+	}
 
 	http.HandleFunc("/api/register", api.HandleRegister(userStore, logStore))
-	http.HandleFunc("/api/login", api.HandleLogin(userStore, logStore))
-	http.Handle("/ws", signaling.HandleWebSocket(userStore, logStore))
+	http.HandleFunc("/api/login", api.HandleLogin(userStore, sessionStore, logStore))
+	http.Handle("/ws", signaling.HandleWebSocket(rooms, userStore, sessionStore, roomStore, inviteStore, chatStore, logStore, iceServers, origins, cfg.WSQueryPassword))
+
+	authMiddleware := auth.AuthMiddleware(userStore, sessionStore)
 
 	logsHandler := http.HandlerFunc(api.HandleGetUserLogs(logStore))
 
-	http.Handle("/api/logs", auth.AuthMiddleware(userStore)(logsHandler))
+	http.Handle("/api/logs", authMiddleware(logsHandler))
+	http.Handle("GET /api/ice-servers", authMiddleware(api.HandleGetICEServers(iceServers)))
+
+	// Сессии
+	http.Handle("POST /api/logout", authMiddleware(api.HandleLogout(sessionStore, logStore)))
+	http.Handle("GET /api/sessions", authMiddleware(api.HandleListSessions(sessionStore)))
+	http.Handle("DELETE /api/sessions/{id}", authMiddleware(api.HandleRevokeSession(sessionStore, logStore)))
+
+	// Комнаты
+	http.Handle("POST /api/rooms", authMiddleware(api.HandleCreateRoom(roomStore, logStore)))
+	http.Handle("GET /api/rooms", authMiddleware(api.HandleListRooms(roomStore)))
+	http.Handle("GET /api/rooms/{id}", authMiddleware(api.HandleGetRoom(roomStore, rooms)))
+	http.Handle("DELETE /api/rooms/{id}", authMiddleware(api.HandleCloseRoom(roomStore, rooms, logStore)))
+	http.Handle("GET /api/rooms/{id}/chat", authMiddleware(api.HandleGetChatHistory(roomStore, chatStore)))
+	http.Handle("GET /api/rooms/{id}/stats", authMiddleware(api.HandleGetRoomStats(roomStore, rooms)))
+	http.Handle("POST /api/rooms/{id}/recording", authMiddleware(api.HandleStartRecording(roomStore, rooms, logStore)))
+	http.Handle("DELETE /api/rooms/{id}/recording", authMiddleware(api.HandleStopRecording(roomStore, rooms, logStore)))
+	http.Handle("POST /api/rooms/{id}/invites", authMiddleware(api.HandleCreateInvite(roomStore, inviteStore, logStore)))
+
+	// Записи
+	http.Handle("GET /api/recordings", authMiddleware(api.HandleListRecordings(recordingIndex, recordingStore)))
+	http.Handle("GET /api/recordings/{room}/{id}", authMiddleware(api.HandleGetRecording(recordingStore, cfg.Recording.URLTTL)))
+	http.Handle("DELETE /api/recordings/{room}/{id}", authMiddleware(api.HandleDeleteRecording(recordingIndex, recordingStore, logStore)))
+	if localStore, ok := recordingStore.(*recording.LocalStore); ok {
+		http.Handle("GET "+recording.LocalURLPrefix+"{key...}", api.HandleRecordingFile(localStore))
+	}
 
 	// Статические файлы
-	fs := http.FileServer(http.Dir("./web"))
+	fs := http.FileServer(http.Dir(cfg.StaticDir))
 
 	// Простой обработчик для всех маршрутов
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -51,11 +144,40 @@ func main() {
 		}
 
 		// Все остальные пути перенаправляем на index.html
-		http.ServeFile(w, r, "./web/index.html")
+		http.ServeFile(w, r, filepath.Join(cfg.StaticDir, "index.html"))
 	})
 
-	// log.Println("Server running on :80")
-	// log.Fatal(http.ListenAndServe(":80", nil))
-	log.Println("Server running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	corsMiddleware := api.CORSMiddleware(origins, sessionStore, logStore)
+	server := &http.Server{Addr: cfg.ListenAddr, Handler: corsMiddleware(http.DefaultServeMux)}
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server running on %s", cfg.ListenAddr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("Ошибка при запуске HTTP-сервера: %w", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Корректная остановка: новые подключения к комнатам отклоняются,
+	// участники получают server_shutdown, а журнал дописывается до закрытия Redis,
+	// которое выполняется отложенно при выходе из run
+	log.Printf("Shutting down, waiting up to %s for active calls", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := rooms.Shutdown(shutdownCtx); err != nil {
+		logging.Warnf("Не все звонки завершились до истечения времени остановки: %v", err)
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logging.Warnf("Ошибка при остановке HTTP-сервера: %v", err)
+	}
+
+	return nil
 }
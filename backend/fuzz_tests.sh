@@ -7,6 +7,7 @@ go test -fuzz=FuzzLoginHandler -fuzztime=10s ./internal/api
 go test -fuzz=FuzzAuthMiddleware -fuzztime=10s ./internal/api
 go test -fuzz=FuzzGetUserLogs -fuzztime=10s ./internal/api
 go test -fuzz=FuzzLogEntryJSON -fuzztime=10s ./internal/api
+go test -fuzz=FuzzCreateRoomHandler -fuzztime=10s ./internal/api
 
 # Запуск фаззинг-тестов для Auth
 echo "Running Auth fuzzing tests..."
@@ -18,5 +19,42 @@ go test -fuzz=FuzzGetLogs -fuzztime=10s ./internal/auth
 go test -fuzz=FuzzGetLogsByTimeRange -fuzztime=10s ./internal/auth
 go test -fuzz=FuzzClearLogs -fuzztime=10s ./internal/auth
 go test -fuzz=FuzzGetUsernameFromContext -fuzztime=10s ./internal/auth
+go test -fuzz=FuzzCreateRoom -fuzztime=10s ./internal/auth
+go test -fuzz=FuzzRoomModeration -fuzztime=10s ./internal/auth
+go test -fuzz=FuzzInviteToken -fuzztime=10s ./internal/auth
+go test -fuzz=FuzzChatHistory -fuzztime=10s ./internal/auth
+go test -fuzz=FuzzLegacyPasswordMigration -fuzztime=10s ./internal/auth
+go test -fuzz=FuzzSessionLifecycle -fuzztime=10s ./internal/auth
+go test -fuzz=FuzzBasicAuthFormats -fuzztime=10s ./internal/auth
+go test -fuzz=FuzzRecordingIndex -fuzztime=10s ./internal/auth
+
+# Запуск фаззинг-тестов для ICE
+echo "Running ICE fuzzing tests..."
+go test -fuzz=FuzzTURNCredentials -fuzztime=10s ./internal/ice
+
+# Запуск фаззинг-тестов для TURN
+echo "Running TURN fuzzing tests..."
+go test -fuzz=FuzzAuthHandler -fuzztime=10s ./internal/turnserver
+
+# Запуск фаззинг-тестов для сигнализации
+echo "Running signaling fuzzing tests..."
+go test -fuzz=FuzzMessageDecode -fuzztime=10s ./internal/signaling
+go test -fuzz=FuzzKeyFrame -fuzztime=10s ./internal/signaling
+go test -fuzz=FuzzSpeakerDetector -fuzztime=10s ./internal/signaling
+go test -fuzz=FuzzLastN -fuzztime=10s ./internal/signaling
+
+# Запуск фаззинг-тестов для записи звонков
+echo "Running recording fuzzing tests..."
+go test -fuzz=FuzzRecorderTrack -fuzztime=10s ./internal/recording
+go test -fuzz=FuzzLocalStore -fuzztime=10s ./internal/recording
+go test -fuzz=FuzzS3Store -fuzztime=10s ./internal/recording
+
+# Запуск фаззинг-тестов для проверки Origin
+echo "Running origin fuzzing tests..."
+go test -fuzz=FuzzAllowlist -fuzztime=10s ./internal/origin
+
+# Запуск фаззинг-тестов для конфигурации
+echo "Running config fuzzing tests..."
+go test -fuzz=FuzzConfigYAML -fuzztime=10s ./internal/config
 
 echo "All fuzzing tests completed!" 
\ No newline at end of file
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Coderovshik/meet/internal/auth"
+)
+
+// HandleGetChatHistory возвращает историю чата комнаты. С параметром
+// format=text история выгружается текстовым файлом. Доступно ведущему и
+// соведущим, после закрытия комнаты - только ее владельцу
+func HandleGetChatHistory(rs *auth.RoomStore, cs *auth.ChatStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		room, err := rs.GetRoom(r.Context(), r.PathValue("id"))
+		if errors.Is(err, auth.ErrRoomNotFound) {
+			http.Error(w, "Комната не найдена", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Ошибка при получении комнаты", http.StatusInternalServerError)
+			return
+		}
+
+		role, err := rs.GetRole(r.Context(), room, username)
+		if err != nil {
+			http.Error(w, "Ошибка при получении роли", http.StatusInternalServerError)
+			return
+		}
+		if !auth.CanModerate(role) {
+			http.Error(w, "Недостаточно прав для просмотра истории чата", http.StatusForbidden)
+			return
+		}
+
+		limit := int64(auth.MaxChatHistory)
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if limit, err = strconv.ParseInt(limitStr, 10, 64); err != nil || limit <= 0 {
+				http.Error(w, "Неверный параметр limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		messages, err := cs.GetMessages(r.Context(), room.ID, limit)
+		if err != nil {
+			http.Error(w, "Ошибка при получении истории чата", http.StatusInternalServerError)
+			return
+		}
+
+		if r.URL.Query().Get("format") == "text" {
+			var export strings.Builder
+			fmt.Fprintf(&export, "Чат комнаты «%s» (%s)\n\n", room.Title, room.ID)
+			for _, msg := range messages {
+				fmt.Fprintf(&export, "[%s] %s: %s\n", msg.Timestamp.Format(time.RFC3339), msg.DisplayName, msg.Text)
+			}
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chat-%s.txt"`, room.ID))
+			if _, err := w.Write([]byte(export.String())); err != nil {
+				fmt.Printf("Ошибка при выгрузке истории чата: %v\n", err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(messages); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/origin"
+)
+
+const (
+	corsAllowMethods = "GET, POST, DELETE, OPTIONS"
+	corsAllowHeaders = "Authorization, Content-Type"
+	corsMaxAge       = "600"
+)
+
+// CORSMiddleware применяет список разрешенных Origin к маршрутам /api/*:
+// отвечает на preflight-запросы, добавляет заголовки CORS для разрешенных
+// сайтов и отклоняет запросы с остальных. Попытка записывается в журнал,
+// только если в запросе был действующий токен сессии
+func CORSMiddleware(origins *origin.Allowlist, ss *auth.SessionStore, ls *auth.LogStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requestOrigin := r.Header.Get("Origin")
+			w.Header().Add("Vary", "Origin")
+
+			if !origins.Allowed(r) {
+				http.Error(w, "Источник запроса не разрешен", http.StatusForbidden)
+				logRejectedOrigin(r, ss, ls)
+				return
+			}
+
+			if requestOrigin != "" {
+				w.Header().Set("Access-Control-Allow-Origin", requestOrigin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// Preflight-запрос браузера перед запросом с заголовком Authorization
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// logRejectedOrigin записывает отклоненный запрос в журнал пользователя, чей
+// токен сессии был в запросе. Запросы без действующего токена не записываются:
+// иначе любой сайт мог бы без ограничений наполнять журнал
+func logRejectedOrigin(r *http.Request, ss *auth.SessionStore, ls *auth.LogStore) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return
+	}
+	session, err := ss.ValidateSession(r.Context(), token)
+	if err != nil {
+		if !errors.Is(err, auth.ErrSessionNotFound) {
+			fmt.Printf("Ошибка при проверке сессии: %v\n", err)
+		}
+		return
+	}
+
+	details := fmt.Sprintf("Origin: %s, Path: %s, IP: %s, User-Agent: %s",
+		r.Header.Get("Origin"), r.URL.Path, r.RemoteAddr, r.UserAgent())
+	if err := ls.AddLog(r.Context(), session.Username, "origin_rejected", details); err != nil {
+		fmt.Printf("Ошибка при логировании запроса с неразрешенного источника: %v\n", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/Coderovshik/meet/internal/auth"
 )
@@ -39,7 +40,7 @@ func HandleRegister(us *auth.UserStore, ls *auth.LogStore) http.HandlerFunc {
 	}
 }
 
-func HandleLogin(us *auth.UserStore, ls *auth.LogStore) http.HandlerFunc {
+func HandleLogin(us *auth.UserStore, ss *auth.SessionStore, ls *auth.LogStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var creds struct {
 			Username string `json:"username"`
@@ -65,13 +66,27 @@ func HandleLogin(us *auth.UserStore, ls *auth.LogStore) http.HandlerFunc {
 			return
 		}
 
+		// Выдаем токен сессии, который используется вместо пароля в последующих запросах
+		token, session, err := ss.CreateSession(r.Context(), creds.Username, r.RemoteAddr, r.UserAgent())
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
 		// Логируем успешный вход
 		details := fmt.Sprintf("IP: %s, User-Agent: %s", r.RemoteAddr, r.UserAgent())
 		if err := ls.AddLog(r.Context(), creds.Username, "login", details); err != nil {
 			fmt.Printf("Ошибка при логировании входа: %v\n", err)
 		}
 
-		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct {
+			Token     string    `json:"token"`
+			SessionID string    `json:"session_id"`
+			ExpiresAt time.Time `json:"expires_at"`
+		}{token, session.ID, session.ExpiresAt}); err != nil {
+			fmt.Printf("Ошибка при сериализации ответа: %v\n", err)
+		}
 	}
 }
 
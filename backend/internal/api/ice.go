@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/ice"
+)
+
+// iceServer повторяет словарь RTCIceServer, который ожидает браузер
+type iceServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// HandleGetICEServers возвращает ICE-серверы, которые использует сервер, вместе
+// с временными учетными данными TURN для текущего пользователя. Учетные данные
+// TURN действуют, пока у пользователя есть сессия, поэтому при входе по паролю
+// они не выдаются
+func HandleGetICEServers(p *ice.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		servers, expiresAt := p.PublicServers(), time.Time{}
+		if _, ok := auth.GetSessionIDFromContext(r.Context()); ok {
+			servers, expiresAt = p.Servers(username)
+		}
+
+		resp := struct {
+			ICEServers []iceServer `json:"ice_servers"`
+			ExpiresAt  *time.Time  `json:"expires_at,omitempty"`
+		}{ICEServers: make([]iceServer, 0, len(servers))}
+		for _, s := range servers {
+			credential, _ := s.Credential.(string)
+			resp.ICEServers = append(resp.ICEServers, iceServer{
+				URLs:       s.URLs,
+				Username:   s.Username,
+				Credential: credential,
+			})
+		}
+		if !expiresAt.IsZero() {
+			resp.ExpiresAt = &expiresAt
+		}
+
+		// Учетные данные временные - запрещаем их кеширование
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Coderovshik/meet/internal/auth"
+)
+
+type inviteResponse struct {
+	auth.Invite
+	Token string `json:"token"`
+	URL   string `json:"url"` // Страница, на которой гость вводит имя и подключается к комнате
+}
+
+// HandleCreateInvite выпускает гостевое приглашение в комнату. Приглашать
+// могут ведущий и соведущие, приглашение с ролью соведущего - только ведущий
+func HandleCreateInvite(rs *auth.RoomStore, is *auth.InviteStore, ls *auth.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			ExpiresIn int    `json:"expires_in"` // секунды
+			MaxUses   int    `json:"max_uses"`
+			Role      string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		room, err := rs.GetOpenRoom(r.Context(), r.PathValue("id"))
+		switch {
+		case errors.Is(err, auth.ErrRoomNotFound):
+			http.Error(w, "Комната не найдена", http.StatusNotFound)
+			return
+		case errors.Is(err, auth.ErrRoomClosed):
+			http.Error(w, "Комната закрыта", http.StatusGone)
+			return
+		case err != nil:
+			http.Error(w, "Ошибка при получении комнаты", http.StatusInternalServerError)
+			return
+		}
+
+		role, err := rs.GetRole(r.Context(), room, username)
+		if err != nil {
+			http.Error(w, "Ошибка при получении роли", http.StatusInternalServerError)
+			return
+		}
+		if !auth.CanModerate(role) || (req.Role == auth.RoleCoHost && role != auth.RoleHost) {
+			http.Error(w, "Недостаточно прав для создания приглашения", http.StatusForbidden)
+			return
+		}
+
+		ttl := time.Duration(req.ExpiresIn) * time.Second
+		token, invite, err := is.CreateInvite(room.ID, username, req.Role, ttl, req.MaxUses)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		details := fmt.Sprintf("Room: %s, Invite: %s, Role: %s, Max uses: %d, Expires: %s",
+			room.ID, invite.ID, invite.Role, invite.MaxUses, invite.ExpiresAt.Format(time.RFC3339))
+		if err := ls.AddLog(r.Context(), username, "invite_created", details); err != nil {
+			fmt.Printf("Ошибка при логировании создания приглашения: %v\n", err)
+		}
+
+		resp := inviteResponse{
+			Invite: *invite,
+			Token:  token,
+			URL:    "/join?room=" + url.QueryEscape(room.ID) + "&invite=" + url.QueryEscape(token),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			fmt.Printf("Ошибка при сериализации ответа: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/recording"
+	"github.com/Coderovshik/meet/internal/signaling"
+)
+
+// hostRoom возвращает комнату из пути запроса, если ее запрашивает ведущий.
+// При ошибке ответ уже отправлен
+func hostRoom(w http.ResponseWriter, r *http.Request, rs *auth.RoomStore) (*auth.Room, string, bool) {
+	username, ok := auth.GetUsernameFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+		return nil, "", false
+	}
+
+	room, err := rs.GetRoom(r.Context(), r.PathValue("id"))
+	if errors.Is(err, auth.ErrRoomNotFound) {
+		http.Error(w, "Комната не найдена", http.StatusNotFound)
+		return nil, "", false
+	} else if err != nil {
+		http.Error(w, "Ошибка при получении комнаты", http.StatusInternalServerError)
+		return nil, "", false
+	}
+
+	role, err := rs.GetRole(r.Context(), room, username)
+	if err != nil {
+		http.Error(w, "Ошибка при получении роли", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	if role != auth.RoleHost {
+		http.Error(w, "Управлять записью может только ведущий", http.StatusForbidden)
+		return nil, "", false
+	}
+
+	return room, username, true
+}
+
+// HandleStartRecording включает запись идущего звонка
+func HandleStartRecording(rs *auth.RoomStore, rooms *signaling.RoomRegistry, ls *auth.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		room, username, ok := hostRoom(w, r, rs)
+		if !ok {
+			return
+		}
+
+		id, err := rooms.StartRecording(room.ID, room.Owner, username)
+		switch {
+		case errors.Is(err, signaling.ErrRoomNotActive):
+			http.Error(w, "В комнате нет участников", http.StatusConflict)
+			return
+		case errors.Is(err, signaling.ErrRecordingActive):
+			http.Error(w, "Запись уже идет", http.StatusConflict)
+			return
+		case errors.Is(err, recording.ErrDisabled):
+			http.Error(w, "Запись отключена на сервере", http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, "Ошибка при запуске записи", http.StatusInternalServerError)
+			return
+		}
+
+		details := fmt.Sprintf("Room: %s, Recording: %s", room.ID, id)
+		if err := ls.AddLog(r.Context(), username, "recording_started", details); err != nil {
+			fmt.Printf("Ошибка при логировании начала записи: %v\n", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(map[string]string{"id": id}); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// HandleStopRecording останавливает запись и возвращает ее манифест
+func HandleStopRecording(rs *auth.RoomStore, rooms *signaling.RoomRegistry, ls *auth.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		room, username, ok := hostRoom(w, r, rs)
+		if !ok {
+			return
+		}
+
+		manifest, err := rooms.StopRecording(room.ID, username)
+		switch {
+		case errors.Is(err, signaling.ErrRoomNotActive), errors.Is(err, signaling.ErrNotRecording):
+			http.Error(w, "Запись не идет", http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "Ошибка при остановке записи", http.StatusInternalServerError)
+			return
+		}
+
+		details := fmt.Sprintf("Room: %s, Recording: %s", room.ID, manifest.ID)
+		if err := ls.AddLog(r.Context(), username, "recording_stopped", details); err != nil {
+			fmt.Printf("Ошибка при логировании остановки записи: %v\n", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(manifest); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// recordingDetails - манифест записи со ссылками на скачивание ее файлов
+type recordingDetails struct {
+	recording.Manifest
+	// Files сопоставляет имя файла дорожки или манифеста со ссылкой на него
+	Files     map[string]string `json:"files"`
+	ExpiresAt time.Time         `json:"urls_expire_at"`
+}
+
+// recordingAccess сообщает, может ли пользователь просматривать запись и
+// управлять ею. Смотреть запись могут ее участники и ведущий комнаты на момент
+// записи, удалять - только этот ведущий. Права берутся из манифеста и не
+// зависят от того, что стало с комнатой после записи
+func recordingAccess(manifest *recording.Manifest, username string) (view, manage bool) {
+	host := manifest.Host
+	if host == "" {
+		// Манифесты без поля host: запись мог включить только ведущий
+		host = manifest.StartedBy
+	}
+	manage = host == username
+
+	view = manage || manifest.StartedBy == username
+	for _, participant := range manifest.Participants {
+		if participant.Username == username {
+			view = true
+		}
+	}
+
+	return view, manage
+}
+
+// loadRecording читает манифест записи из пути запроса и проверяет доступ.
+// При ошибке ответ уже отправлен
+func loadRecording(w http.ResponseWriter, r *http.Request, store recording.RecordingStore) (*recording.Manifest, string, bool, bool) {
+	username, ok := auth.GetUsernameFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+		return nil, "", false, false
+	}
+
+	manifest, err := recording.LoadManifest(r.Context(), store, r.PathValue("room"), r.PathValue("id"))
+	if errors.Is(err, recording.ErrNotFound) || errors.Is(err, recording.ErrInvalidKey) {
+		http.Error(w, "Запись не найдена", http.StatusNotFound)
+		return nil, "", false, false
+	} else if err != nil {
+		http.Error(w, "Ошибка при получении записи", http.StatusInternalServerError)
+		return nil, "", false, false
+	}
+
+	view, manage := recordingAccess(manifest, username)
+	if !view {
+		// Чужие записи неотличимы от несуществующих
+		http.Error(w, "Запись не найдена", http.StatusNotFound)
+		return nil, "", false, false
+	}
+
+	return manifest, username, manage, true
+}
+
+// HandleListRecordings возвращает манифесты записей, доступных пользователю,
+// начиная с самых новых. Параметр room ограничивает список одной комнатой
+func HandleListRecordings(index *auth.RecordingIndex, store recording.RecordingStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		refs, err := index.ListRecordings(r.Context(), username, r.URL.Query().Get("room"))
+		if err != nil {
+			http.Error(w, "Ошибка при получении записей", http.StatusInternalServerError)
+			return
+		}
+
+		visible := make([]*recording.Manifest, 0, len(refs))
+		for _, ref := range refs {
+			manifest, err := recording.LoadManifest(r.Context(), store, ref.RoomID, ref.ID)
+			if errors.Is(err, recording.ErrNotFound) || errors.Is(err, recording.ErrInvalidKey) {
+				// Запись удалили из хранилища в обход API
+				continue
+			} else if err != nil {
+				http.Error(w, "Ошибка при получении записей", http.StatusInternalServerError)
+				return
+			}
+			if view, _ := recordingAccess(manifest, username); view {
+				visible = append(visible, manifest)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(visible); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// HandleGetRecording возвращает манифест записи с подписанными ссылками на файлы
+func HandleGetRecording(store recording.RecordingStore, ttl time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		manifest, _, _, ok := loadRecording(w, r, store)
+		if !ok {
+			return
+		}
+
+		resp := recordingDetails{
+			Manifest:  *manifest,
+			Files:     make(map[string]string, len(manifest.Tracks)+1),
+			ExpiresAt: time.Now().Add(ttl).UTC(),
+		}
+		files := []string{recording.ManifestFile}
+		for _, track := range manifest.Tracks {
+			files = append(files, track.File)
+		}
+		for _, file := range files {
+			url, err := store.SignedURL(r.Context(), recording.Key(manifest.RoomID, manifest.ID, file), ttl)
+			if err != nil {
+				http.Error(w, "Ошибка при создании ссылки на файл", http.StatusInternalServerError)
+				return
+			}
+			resp.Files[file] = url
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// HandleDeleteRecording удаляет запись вместе с файлами. Доступно ведущему комнаты
+func HandleDeleteRecording(index *auth.RecordingIndex, store recording.RecordingStore, ls *auth.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		manifest, username, manage, ok := loadRecording(w, r, store)
+		if !ok {
+			return
+		}
+		if !manage {
+			http.Error(w, "Удалять записи может только ведущий", http.StatusForbidden)
+			return
+		}
+
+		err := recording.DeleteRecording(r.Context(), store, manifest.RoomID, manifest.ID)
+		if errors.Is(err, recording.ErrNotFound) {
+			http.Error(w, "Запись не найдена", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Ошибка при удалении записи", http.StatusInternalServerError)
+			return
+		}
+		if err := index.RemoveRecording(r.Context(), manifest.RoomID, manifest.ID, manifest.Usernames()); err != nil {
+			fmt.Printf("Ошибка при удалении записи из списков пользователей: %v\n", err)
+		}
+
+		details := fmt.Sprintf("Room: %s, Recording: %s", manifest.RoomID, manifest.ID)
+		if err := ls.AddLog(r.Context(), username, "recording_deleted", details); err != nil {
+			fmt.Printf("Ошибка при логировании удаления записи: %v\n", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleRecordingFile отдает файл локального хранилища по подписанной ссылке.
+// Авторизация не нужна: доступ дает подпись, выданная HandleGetRecording
+func HandleRecordingFile(store *recording.LocalStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		query := r.URL.Query()
+
+		err := store.Verify(key, query.Get("expires"), query.Get("signature"))
+		if errors.Is(err, recording.ErrURLExpired) {
+			http.Error(w, "Срок действия ссылки истек", http.StatusForbidden)
+			return
+		} else if err != nil {
+			http.Error(w, "Недействительная ссылка", http.StatusForbidden)
+			return
+		}
+
+		file, err := store.Get(r.Context(), key)
+		if errors.Is(err, recording.ErrNotFound) {
+			http.Error(w, "Файл не найден", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Ошибка при чтении файла", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		switch path.Ext(key) {
+		case ".ogg":
+			w.Header().Set("Content-Type", "audio/ogg")
+		case ".ivf":
+			w.Header().Set("Content-Type", "video/x-ivf")
+		case ".json":
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(key)))
+
+		// Файлы локального хранилища поддерживают Range-запросы для перемотки
+		if seeker, ok := file.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, path.Base(key), time.Time{}, seeker)
+			return
+		}
+		if _, err := io.Copy(w, file); err != nil {
+			fmt.Printf("Ошибка при отправке файла записи: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/signaling"
+)
+
+type roomDetails struct {
+	auth.Room
+	Participants []string `json:"participants"`
+}
+
+// HandleCreateRoom создает комнату от имени текущего пользователя
+func HandleCreateRoom(rs *auth.RoomStore, ls *auth.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Title           string `json:"title"`
+			MaxParticipants int    `json:"max_participants"`
+			Lobby           bool   `json:"lobby"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		room, err := rs.CreateRoom(r.Context(), username, req.Title, req.MaxParticipants)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Lobby {
+			if room, err = rs.SetLobby(r.Context(), room.ID, true); err != nil {
+				http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		details := fmt.Sprintf("Room: %s, Title: %s", room.ID, room.Title)
+		if err := ls.AddLog(r.Context(), username, "room_created", details); err != nil {
+			fmt.Printf("Ошибка при логировании создания комнаты: %v\n", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(room); err != nil {
+			fmt.Printf("Ошибка при сериализации ответа: %v\n", err)
+		}
+	}
+}
+
+// HandleListRooms возвращает комнаты, созданные текущим пользователем
+func HandleListRooms(rs *auth.RoomStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		rooms, err := rs.ListRooms(r.Context(), username)
+		if err != nil {
+			http.Error(w, "Ошибка при получении комнат", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rooms); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// HandleGetRoom возвращает информацию о комнате вместе со списком текущих участников.
+// Комнату видят ее владелец и те, кто сейчас в ней; остальным она не видна
+func HandleGetRoom(rs *auth.RoomStore, rooms *signaling.RoomRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		room, err := rs.GetRoom(r.Context(), r.PathValue("id"))
+		if errors.Is(err, auth.ErrRoomNotFound) {
+			http.Error(w, "Комната не найдена", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Ошибка при получении комнаты", http.StatusInternalServerError)
+			return
+		}
+
+		participants := rooms.Participants(room.ID)
+		if room.Owner != username && !slices.Contains(participants, username) {
+			http.Error(w, "Комната не найдена", http.StatusNotFound)
+			return
+		}
+
+		resp := roomDetails{
+			Room:         *room,
+			Participants: participants,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// HandleCloseRoom закрывает комнату и отключает всех ее участников.
+// Закрыть комнату может только ее владелец
+func HandleCloseRoom(rs *auth.RoomStore, rooms *signaling.RoomRegistry, ls *auth.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		room, err := rs.GetRoom(r.Context(), r.PathValue("id"))
+		if errors.Is(err, auth.ErrRoomNotFound) {
+			http.Error(w, "Комната не найдена", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Ошибка при получении комнаты", http.StatusInternalServerError)
+			return
+		}
+		if room.Owner != username {
+			http.Error(w, "Закрыть комнату может только ее владелец", http.StatusForbidden)
+			return
+		}
+
+		if _, err := rs.CloseRoom(r.Context(), room.ID); errors.Is(err, auth.ErrRoomClosed) {
+			http.Error(w, "Комната уже закрыта", http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, "Ошибка при закрытии комнаты", http.StatusInternalServerError)
+			return
+		}
+
+		rooms.CloseRoom(room.ID)
+
+		details := fmt.Sprintf("Room: %s, Title: %s", room.ID, room.Title)
+		if err := ls.AddLog(r.Context(), username, "room_closed", details); err != nil {
+			fmt.Printf("Ошибка при логировании закрытия комнаты: %v\n", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
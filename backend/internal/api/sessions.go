@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Coderovshik/meet/internal/auth"
+)
+
+type sessionInfo struct {
+	auth.Session
+	Current bool `json:"current"`
+}
+
+// HandleLogout завершает сессию, токен которой использован в запросе
+func HandleLogout(ss *auth.SessionStore, ls *auth.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+		sessionID, ok := auth.GetSessionIDFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Запрос выполнен без токена сессии", http.StatusBadRequest)
+			return
+		}
+
+		if err := ss.RevokeSession(r.Context(), username, sessionID); err != nil && !errors.Is(err, auth.ErrSessionNotFound) {
+			http.Error(w, "Ошибка при завершении сессии", http.StatusInternalServerError)
+			return
+		}
+
+		details := fmt.Sprintf("IP: %s, User-Agent: %s", r.RemoteAddr, r.UserAgent())
+		if err := ls.AddLog(r.Context(), username, "logout", details); err != nil {
+			fmt.Printf("Ошибка при логировании выхода: %v\n", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListSessions возвращает активные сессии текущего пользователя
+func HandleListSessions(ss *auth.SessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+		currentID, _ := auth.GetSessionIDFromContext(r.Context())
+
+		sessions, err := ss.ListSessions(r.Context(), username)
+		if err != nil {
+			http.Error(w, "Ошибка при получении сессий", http.StatusInternalServerError)
+			return
+		}
+
+		resp := make([]sessionInfo, 0, len(sessions))
+		for _, session := range sessions {
+			resp = append(resp, sessionInfo{Session: session, Current: session.ID == currentID})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// HandleRevokeSession завершает одну из сессий текущего пользователя
+func HandleRevokeSession(ss *auth.SessionStore, ls *auth.LogStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		sessionID := r.PathValue("id")
+		if err := ss.RevokeSession(r.Context(), username, sessionID); errors.Is(err, auth.ErrSessionNotFound) {
+			http.Error(w, "Сессия не найдена", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Ошибка при завершении сессии", http.StatusInternalServerError)
+			return
+		}
+
+		details := fmt.Sprintf("Session: %s, IP: %s", sessionID, r.RemoteAddr)
+		if err := ls.AddLog(r.Context(), username, "session_revoked", details); err != nil {
+			fmt.Printf("Ошибка при логировании завершения сессии: %v\n", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/signaling"
+)
+
+// HandleGetRoomStats возвращает оценку пропускной способности и состояние
+// пересылаемых треков для каждого участника звонка. Доступно ведущему и соведущим
+func HandleGetRoomStats(rs *auth.RoomStore, rooms *signaling.RoomRegistry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, ok := auth.GetUsernameFromContext(r.Context())
+		if !ok {
+			http.Error(w, "Пользователь не авторизован", http.StatusUnauthorized)
+			return
+		}
+
+		room, err := rs.GetRoom(r.Context(), r.PathValue("id"))
+		if errors.Is(err, auth.ErrRoomNotFound) {
+			http.Error(w, "Комната не найдена", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Ошибка при получении комнаты", http.StatusInternalServerError)
+			return
+		}
+
+		role, err := rs.GetRole(r.Context(), room, username)
+		if err != nil {
+			http.Error(w, "Ошибка при получении роли", http.StatusInternalServerError)
+			return
+		}
+		if !auth.CanModerate(role) {
+			http.Error(w, "Недостаточно прав для просмотра статистики", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rooms.Stats(room.ID)); err != nil {
+			http.Error(w, "Ошибка при сериализации ответа", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -2,8 +2,11 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,6 +31,14 @@ func setupTestEnv(t *testing.T) (*UserStore, *LogStore, *miniredis.Miniredis) {
 	return userStore, logStore, mr
 }
 
+// newSessionStore создает хранилище сессий поверх того же miniredis
+func newSessionStore(mr *miniredis.Miniredis) *SessionStore {
+	client := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	return NewSessionStore(client, DefaultSessionTTL)
+}
+
 // FuzzCreateUser тестирует функцию создания пользователя с различными входными данными
 func FuzzCreateUser(f *testing.F) {
 	// Добавляем начальные корпусы для фаззера
@@ -86,6 +97,7 @@ func FuzzAuthMiddleware(f *testing.F) {
 	f.Add("Basic user1:")
 	f.Add("Basic :pass123")
 	f.Add("Bearer token123")
+	f.Add("Bearer ")
 	f.Add("")
 	f.Add("user1:pass123")
 	f.Add("Basic user1:pass123:extra")
@@ -125,7 +137,7 @@ func FuzzAuthMiddleware(f *testing.F) {
 		})
 
 		// Оборачиваем тестовый обработчик в middleware
-		handler := AuthMiddleware(userStore)(testHandler)
+		handler := AuthMiddleware(userStore, newSessionStore(mr))(testHandler)
 
 		// Выполняем запрос, проверяем что middleware не паникует
 		handler.ServeHTTP(rr, req)
@@ -284,3 +296,489 @@ func FuzzGetUsernameFromContext(f *testing.F) {
 		}
 	})
 }
+
+// FuzzCreateRoom тестирует функцию создания комнаты с различными входными данными
+func FuzzCreateRoom(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("user1", "Планерка", 10)
+	f.Add("", "Планерка", 10)
+	f.Add("user1", "", 10)
+	f.Add("user1", "Планерка", 0)
+	f.Add("user1", "Планерка", -1)
+	f.Add("user1", "Планерка", 1000)
+	f.Add("user1", string([]byte{0xff, 0xfe}), 10) // Невалидные UTF-8 байты
+
+	f.Fuzz(func(t *testing.T, owner, title string, maxParticipants int) {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("Ошибка при запуске miniredis: %v", err)
+		}
+		defer mr.Close()
+
+		roomStore := NewRoomStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+		room, err := roomStore.CreateRoom(context.Background(), owner, title, maxParticipants)
+		if err != nil {
+			return
+		}
+
+		// Созданная комната должна находиться и попадать в список комнат владельца
+		if _, err := roomStore.GetOpenRoom(context.Background(), room.ID); err != nil {
+			t.Errorf("Не удалось получить созданную комнату: %v", err)
+		}
+		rooms, err := roomStore.ListRooms(context.Background(), owner)
+		if err != nil || len(rooms) != 1 {
+			t.Errorf("ListRooms вернул %d комнат, ошибка: %v", len(rooms), err)
+		}
+
+		// После закрытия комната не должна быть доступна для подключения
+		if _, err := roomStore.CloseRoom(context.Background(), room.ID); err != nil {
+			t.Errorf("Не удалось закрыть комнату: %v", err)
+		}
+		if _, err := roomStore.GetOpenRoom(context.Background(), room.ID); err != ErrRoomClosed {
+			t.Errorf("GetOpenRoom вернул %v для закрытой комнаты", err)
+		}
+	})
+}
+
+// FuzzRoomModeration проверяет роли, блокировки и запирание комнаты,
+// а также то, что они сбрасываются при закрытии комнаты
+func FuzzRoomModeration(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("user2", "co_host", true)
+	f.Add("user2", "viewer", false)
+	f.Add("user2", "participant", true)
+	f.Add("user2", "host", false)
+	f.Add("owner1", "viewer", true)
+	f.Add("", "", false)
+
+	f.Fuzz(func(t *testing.T, username, role string, locked bool) {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("Ошибка при запуске miniredis: %v", err)
+		}
+		defer mr.Close()
+
+		ctx := context.Background()
+		roomStore := NewRoomStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+		room, err := roomStore.CreateRoom(ctx, "owner1", "Планерка", 10)
+		if err != nil {
+			t.Fatalf("Не удалось создать комнату: %v", err)
+		}
+
+		// Роль ведущего не назначается, владелец всегда ведущий
+		assignable := role == RoleCoHost || role == RoleParticipant || role == RoleViewer
+		if err := roomStore.SetRole(ctx, room.ID, username, role); (err == nil) != assignable {
+			t.Errorf("SetRole(%q) вернул %v", role, err)
+		}
+		got, err := roomStore.GetRole(ctx, room, username)
+		if err != nil {
+			t.Fatalf("Не удалось получить роль: %v", err)
+		}
+		switch {
+		case username == room.Owner:
+			if got != RoleHost {
+				t.Errorf("Владелец получил роль %q", got)
+			}
+		case role == RoleCoHost || role == RoleViewer:
+			if got != role {
+				t.Errorf("Ожидалась роль %q, получена %q", role, got)
+			}
+		default:
+			if got != RoleParticipant {
+				t.Errorf("Ожидалась роль участника, получена %q", got)
+			}
+		}
+
+		if err := roomStore.BanUser(ctx, room.ID, username); err != nil {
+			t.Fatalf("Не удалось заблокировать пользователя: %v", err)
+		}
+		if banned, err := roomStore.IsBanned(ctx, room.ID, username); err != nil || !banned {
+			t.Errorf("Пользователь не заблокирован: %v", err)
+		}
+
+		// Блокировка гостя действует на приглашение и не задевает пользователей
+		if err := roomStore.BanInvite(ctx, room.ID, username); err != nil {
+			t.Fatalf("Не удалось заблокировать приглашение: %v", err)
+		}
+		if banned, err := roomStore.IsInviteBanned(ctx, room.ID, username); err != nil || !banned {
+			t.Errorf("Приглашение не заблокировано: %v", err)
+		}
+		if banned, _ := roomStore.IsBanned(ctx, room.ID, username+"0"); banned {
+			t.Errorf("Блокировка приглашения задела пользователя")
+		}
+
+		if _, err := roomStore.SetLocked(ctx, room.ID, locked); err != nil {
+			t.Fatalf("Не удалось запереть комнату: %v", err)
+		}
+		if stored, err := roomStore.GetRoom(ctx, room.ID); err != nil || stored.Locked != locked {
+			t.Errorf("Состояние запирания не сохранилось: %v", err)
+		}
+
+		// Одновременные изменения разных настроек не затирают друг друга
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := roomStore.SetLocked(ctx, room.ID, !locked); err != nil {
+				t.Errorf("Не удалось запереть комнату: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := roomStore.SetLobby(ctx, room.ID, locked); err != nil {
+				t.Errorf("Не удалось включить зал ожидания: %v", err)
+			}
+		}()
+		wg.Wait()
+		if stored, err := roomStore.GetRoom(ctx, room.ID); err != nil || stored.Locked != !locked || stored.Lobby != locked {
+			t.Errorf("Одновременное изменение настроек потерялось: %+v, %v", stored, err)
+		}
+
+		// Закрытие комнаты сбрасывает роли и блокировки
+		if _, err := roomStore.CloseRoom(ctx, room.ID); err != nil {
+			t.Fatalf("Не удалось закрыть комнату: %v", err)
+		}
+		if banned, _ := roomStore.IsBanned(ctx, room.ID, username); banned {
+			t.Errorf("Блокировка пережила закрытие комнаты")
+		}
+		if banned, _ := roomStore.IsInviteBanned(ctx, room.ID, username); banned {
+			t.Errorf("Блокировка приглашения пережила закрытие комнаты")
+		}
+		if _, err := roomStore.SetLocked(ctx, room.ID, locked); !errors.Is(err, ErrRoomClosed) {
+			t.Errorf("Закрытую комнату удалось изменить: %v", err)
+		}
+		if stored, err := roomStore.GetRoom(ctx, room.ID); err != nil || stored.Status != RoomStatusClosed {
+			t.Errorf("Закрытая комната снова открыта: %v", err)
+		}
+		if got, _ := roomStore.GetRole(ctx, room, username); username != room.Owner && got != RoleParticipant {
+			t.Errorf("Роль %q пережила закрытие комнаты", got)
+		}
+	})
+}
+
+// FuzzInviteToken проверяет подпись гостевых приглашений и ограничение числа использований
+func FuzzInviteToken(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("viewer", 3, int64(3600), 0, byte('x'))
+	f.Add("", 0, int64(0), 5, byte('A'))
+	f.Add("co_host", 1, int64(60), 10, byte('.'))
+	f.Add("host", 1, int64(60), 0, byte(0))
+	f.Add("participant", -1, int64(-5), 3, byte('='))
+
+	f.Fuzz(func(t *testing.T, role string, maxUses int, ttlSeconds int64, flipAt int, flip byte) {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("Ошибка при запуске miniredis: %v", err)
+		}
+		defer mr.Close()
+
+		ctx := context.Background()
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		inviteStore := NewInviteStore(client, []byte("0123456789abcdef"))
+
+		if ttlSeconds < 0 || ttlSeconds > int64(MaxInviteTTL/time.Second) || maxUses > 20 {
+			return
+		}
+		token, invite, err := inviteStore.CreateInvite("room1", "owner1", role, time.Duration(ttlSeconds)*time.Second, maxUses)
+		if err != nil {
+			return
+		}
+
+		// Токен с другой подписью или содержимым не должен приниматься
+		if flipAt = flipAt % len(token); flipAt < 0 {
+			flipAt += len(token)
+		}
+		if tampered := token[:flipAt] + string(flip) + token[flipAt+1:]; tampered != token {
+			if _, err := inviteStore.ParseInvite(tampered); err == nil {
+				t.Errorf("Принят измененный токен %q", tampered)
+			}
+		}
+		if _, err := NewInviteStore(client, []byte("another secret!!")).ParseInvite(token); err == nil {
+			t.Errorf("Принят токен, подписанный другим секретом")
+		}
+
+		parsed, err := inviteStore.ParseInvite(token)
+		if err != nil {
+			t.Fatalf("Не удалось разобрать приглашение: %v", err)
+		}
+		if parsed.ID != invite.ID || parsed.RoomID != "room1" || parsed.Inviter != "owner1" || parsed.Role != invite.Role {
+			t.Errorf("Приглашение изменилось: %+v", parsed)
+		}
+
+		// Приглашение можно использовать не больше MaxUses раз
+		attempts := maxUses + 1
+		if maxUses == 0 {
+			attempts = 3
+		}
+		for i := 1; i <= attempts; i++ {
+			_, err := inviteStore.RedeemInvite(ctx, token)
+			if exhausted := maxUses > 0 && i > maxUses; exhausted != errors.Is(err, ErrInviteExhausted) {
+				t.Fatalf("Использование %d из %d: %v", i, maxUses, err)
+			}
+		}
+	})
+}
+
+// FuzzChatHistory проверяет сохранение сообщений чата и ограничение длины истории
+func FuzzChatHistory(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("Привет всем", 3)
+	f.Add("   ", 1)
+	f.Add("", 1)
+	f.Add(strings.Repeat("a", 2001), 1)
+	f.Add("ok", MaxChatHistory+2)
+	f.Add(string([]byte{0xff, 0xfe}), 1) // Невалидные UTF-8 байты
+
+	f.Fuzz(func(t *testing.T, text string, count int) {
+		if count <= 0 || count > MaxChatHistory+5 {
+			return
+		}
+
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("Ошибка при запуске miniredis: %v", err)
+		}
+		defer mr.Close()
+
+		ctx := context.Background()
+		chatStore := NewChatStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+		var last *ChatMessage
+		for i := 0; i < count; i++ {
+			msg, err := chatStore.AddMessage(ctx, "room1", ChatMessage{Username: "user1", DisplayName: "user1", Text: text})
+			if err != nil {
+				if !errors.Is(err, ErrInvalidChatMessage) {
+					t.Fatalf("Неожиданная ошибка: %v", err)
+				}
+				return
+			}
+			last = msg
+		}
+
+		messages, err := chatStore.GetMessages(ctx, "room1", 0)
+		if err != nil {
+			t.Fatalf("Не удалось получить историю: %v", err)
+		}
+		if want := min(count, MaxChatHistory); len(messages) != want {
+			t.Errorf("Ожидалось %d сообщений, получено %d", want, len(messages))
+		}
+		if messages[len(messages)-1].ID != last.ID {
+			t.Errorf("Последнее сообщение истории не совпадает с отправленным")
+		}
+		if messages[0].Text != strings.TrimSpace(text) {
+			t.Errorf("Текст сообщения изменился: %q", messages[0].Text)
+		}
+	})
+}
+
+// FuzzLegacyPasswordMigration проверяет, что пароль, сохраненный открытым текстом,
+// перехешируется при успешном входе и продолжает проходить проверку
+func FuzzLegacyPasswordMigration(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("pass123", "pass123")
+	f.Add("pass123", "pass124")
+	f.Add("pass123", "")
+	f.Add("$argon2id$v=19$m=1,t=1,p=1$$", "pass123")                      // Поврежденный хеш
+	f.Add("$argon2id$v=19$m=1,t=1,p=1$$", "$argon2id$v=19$m=1,t=1,p=1$$") // Открытый пароль с префиксом хеша
+
+	f.Fuzz(func(t *testing.T, stored, password string) {
+		userStore, _, mr := setupTestEnv(t)
+		defer mr.Close()
+
+		// Имитируем запись, созданную до внедрения хеширования
+		if err := mr.Set("user:user1", stored); err != nil {
+			t.Skip("Не удалось сохранить пароль")
+		}
+
+		valid, err := userStore.ValidateUser(context.Background(), "user1", password)
+		if err != nil || !valid {
+			return
+		}
+
+		migrated, err := mr.Get("user:user1")
+		if err != nil || !isPasswordHash(migrated) {
+			t.Fatalf("Пароль не был перехеширован: %q", migrated)
+		}
+
+		valid, err = userStore.ValidateUser(context.Background(), "user1", password)
+		if err != nil || !valid {
+			t.Errorf("Перехешированный пароль не прошел проверку: %v", err)
+		}
+	})
+}
+
+// FuzzSessionLifecycle тестирует выдачу, проверку и отзыв токенов сессий
+func FuzzSessionLifecycle(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("user1", "token123")
+	f.Add("user1", "")
+	f.Add("", "token123")
+	f.Add("usr", "token123")                     // Короткое имя
+	f.Add("user!@#", string([]byte{0xff, 0xfe})) // Невалидные UTF-8 байты
+
+	f.Fuzz(func(t *testing.T, username, forgedToken string) {
+		_, _, mr := setupTestEnv(t)
+		defer mr.Close()
+
+		sessionStore := newSessionStore(mr)
+		ctx := context.Background()
+
+		token, session, err := sessionStore.CreateSession(ctx, username, "127.0.0.1", "fuzz")
+		if err != nil {
+			return // Сессия выдается только пользователям с допустимым именем
+		}
+
+		// Выданный токен должен проходить проверку, подделанный - нет
+		validated, err := sessionStore.ValidateSession(ctx, token)
+		if err != nil || validated.Username != username {
+			t.Fatalf("Выданный токен не прошел проверку: %v", err)
+		}
+		if forgedToken != token {
+			if _, err := sessionStore.ValidateSession(ctx, forgedToken); err != ErrSessionNotFound {
+				t.Errorf("Подделанный токен %q прошел проверку: %v", forgedToken, err)
+			}
+		}
+
+		if active, err := sessionStore.HasActiveSession(ctx, username); err != nil || !active {
+			t.Errorf("HasActiveSession не видит выданную сессию: %v", err)
+		}
+		// Список сессий пользователя не должен жить дольше самих сессий
+		if ttl := mr.TTL("sessions:" + username); ttl <= 0 || ttl > DefaultSessionTTL {
+			t.Errorf("Список сессий хранится со сроком %v", ttl)
+		}
+
+		// Чужую сессию отозвать нельзя
+		if err := sessionStore.RevokeSession(ctx, username+"x", session.ID); err != ErrSessionNotFound {
+			t.Errorf("Удалось отозвать чужую сессию: %v", err)
+		}
+
+		if err := sessionStore.RevokeSession(ctx, username, session.ID); err != nil {
+			t.Fatalf("Не удалось отозвать сессию: %v", err)
+		}
+		if _, err := sessionStore.ValidateSession(ctx, token); err != ErrSessionNotFound {
+			t.Errorf("Отозванный токен прошел проверку: %v", err)
+		}
+		if sessions, err := sessionStore.ListSessions(ctx, username); err != nil || len(sessions) != 0 {
+			t.Errorf("ListSessions вернул %d сессий после отзыва, ошибка: %v", len(sessions), err)
+		}
+		if active, err := sessionStore.HasActiveSession(ctx, username); err != nil || active {
+			t.Errorf("HasActiveSession видит отозванную сессию: %v", err)
+		}
+	})
+}
+
+// FuzzBasicAuthFormats проверяет, что middleware принимает как заголовок Basic
+// по RFC 7617, так и незакодированный формат фронтенда
+func FuzzBasicAuthFormats(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("user1", "pass123")
+	f.Add("user1", "pa:ss")
+	f.Add("user1", "")
+	f.Add("", "pass123")
+	f.Add("user:1", "pass123")
+
+	f.Fuzz(func(t *testing.T, username, password string) {
+		userStore, _, mr := setupTestEnv(t)
+		defer mr.Close()
+
+		if err := userStore.CreateUser(context.Background(), username, password); err != nil {
+			return // Проверяем только существующих пользователей
+		}
+
+		handler := AuthMiddleware(userStore, newSessionStore(mr))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got, _ := GetUsernameFromContext(r.Context()); got != username {
+				t.Errorf("В контексте имя %q вместо %q", got, username)
+			}
+		}))
+
+		// Стандартный формат, который используют curl -u и SetBasicAuth
+		req := httptest.NewRequest("GET", "/api/logs", nil)
+		req.SetBasicAuth(username, password)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("RFC 7617 Basic: код %d", rr.Code)
+		}
+
+		// Незакодированный формат фронтенда
+		req = httptest.NewRequest("GET", "/api/logs", nil)
+		req.Header.Set("Authorization", "Basic "+username+":"+password)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("Незакодированный Basic: код %d", rr.Code)
+		}
+
+		// Неверный пароль должен приводить к 401 с вызовом WWW-Authenticate
+		req = httptest.NewRequest("GET", "/api/logs", nil)
+		req.SetBasicAuth(username, password+"x")
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Неверный пароль: код %d, WWW-Authenticate %q", rr.Code, rr.Header().Get("WWW-Authenticate"))
+		}
+	})
+}
+
+// FuzzRecordingIndex проверяет списки записей пользователей: порядок от новых
+// к старым, фильтр по комнате, пропуск гостей и удаление
+func FuzzRecordingIndex(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("user1", "room1", "rec1")
+	f.Add("guest-0123456789abcdef", "room1", "rec1") // Гость
+	f.Add("user1", "room/1", "rec1")                 // Разделитель в идентификаторе комнаты
+	f.Add("user1", "", "")
+
+	f.Fuzz(func(t *testing.T, username, roomID, id string) {
+		_, _, mr := setupTestEnv(t)
+		defer mr.Close()
+
+		ctx := context.Background()
+		index := NewRecordingIndex(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+		startedAt := time.Unix(1700000000, 0)
+		if err := index.AddRecording(ctx, roomID, id, startedAt, []string{username, username}); err != nil {
+			t.Fatalf("Не удалось добавить запись: %v", err)
+		}
+		if err := index.AddRecording(ctx, "other", "newer", startedAt.Add(time.Hour), []string{username}); err != nil {
+			t.Fatalf("Не удалось добавить запись: %v", err)
+		}
+
+		refs, err := index.ListRecordings(ctx, username, "")
+		if err != nil {
+			t.Fatalf("Не удалось получить записи: %v", err)
+		}
+		if !usernameRegex.MatchString(username) {
+			if len(refs) != 0 {
+				t.Errorf("Записи гостя попали в индекс: %v", refs)
+			}
+			return
+		}
+		if len(refs) == 0 || refs[0] != (RecordingRef{RoomID: "other", ID: "newer"}) {
+			t.Fatalf("Первой должна идти самая новая запись: %v", refs)
+		}
+
+		// Записи без разделителя в идентификаторе комнаты находятся по комнате
+		if !strings.Contains(roomID, "/") && roomID != "" && roomID != "other" {
+			filtered, err := index.ListRecordings(ctx, username, roomID)
+			if err != nil || len(filtered) != 1 || filtered[0] != (RecordingRef{RoomID: roomID, ID: id}) {
+				t.Errorf("Фильтр по комнате вернул %v, ошибка: %v", filtered, err)
+			}
+		}
+
+		if err := index.RemoveRecording(ctx, "other", "newer", []string{username}); err != nil {
+			t.Fatalf("Не удалось удалить запись: %v", err)
+		}
+		refs, err = index.ListRecordings(ctx, username, "")
+		if err != nil {
+			t.Fatalf("Не удалось получить записи: %v", err)
+		}
+		for _, ref := range refs {
+			if ref == (RecordingRef{RoomID: "other", ID: "newer"}) {
+				t.Errorf("Удаленная запись осталась в списке")
+			}
+		}
+	})
+}
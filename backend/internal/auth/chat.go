@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// MaxChatHistory - сколько последних сообщений комнаты хранится в Redis
+	MaxChatHistory       = 500
+	maxChatMessageLength = 2000
+)
+
+var ErrInvalidChatMessage = errors.New("invalid message: 1-2000 characters")
+
+type ChatMessage struct {
+	ID            string    `json:"id"`
+	ParticipantID string    `json:"participant_id,omitempty"`
+	Username      string    `json:"username"`
+	DisplayName   string    `json:"display_name"`
+	Text          string    `json:"text"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+type ChatStore struct {
+	client *redis.Client
+}
+
+func NewChatStore(client *redis.Client) *ChatStore {
+	return &ChatStore{client: client}
+}
+
+// AddMessage проверяет текст, сохраняет сообщение в истории комнаты и
+// возвращает его с присвоенными идентификатором и временем
+func (cs *ChatStore) AddMessage(ctx context.Context, roomID string, msg ChatMessage) (*ChatMessage, error) {
+	msg.Text = strings.TrimSpace(msg.Text)
+	if msg.Text == "" || !utf8.ValidString(msg.Text) || utf8.RuneCountInString(msg.Text) > maxChatMessageLength {
+		return nil, ErrInvalidChatMessage
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	msg.ID = hex.EncodeToString(id)
+	msg.Timestamp = time.Now()
+
+	msgJSON, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Как и журнал действий, история - список с добавлением в конец через RPUSH,
+	// но хранятся только последние MaxChatHistory сообщений
+	key := "chat:" + roomID
+	_, err = cs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, msgJSON)
+		pipe.LTrim(ctx, key, -MaxChatHistory, -1)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
+
+// GetMessages возвращает последние limit сообщений комнаты в хронологическом порядке
+func (cs *ChatStore) GetMessages(ctx context.Context, roomID string, limit int64) ([]ChatMessage, error) {
+	if limit <= 0 || limit > MaxChatHistory {
+		limit = MaxChatHistory
+	}
+
+	entries, err := cs.client.LRange(ctx, "chat:"+roomID, -limit, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]ChatMessage, 0, len(entries))
+	for _, entry := range entries {
+		var msg ChatMessage
+		if err := json.Unmarshal([]byte(entry), &msg); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultInviteTTL = 24 * time.Hour
+	MaxInviteTTL     = 7 * 24 * time.Hour
+	maxInviteUses    = 1000
+
+	maxDisplayNameLength = 32
+	guestUsernamePrefix  = "guest-"
+)
+
+var (
+	ErrInvalidInvite      = errors.New("invalid invite")
+	ErrInviteExpired      = errors.New("invite expired")
+	ErrInviteExhausted    = errors.New("invite has no uses left")
+	ErrInvalidDisplayName = errors.New("invalid display name: 1-32 printable characters")
+)
+
+// Invite - приглашение в комнату. Все поля входят в подписанный токен,
+// поэтому на сервере хранится только счетчик использований
+type Invite struct {
+	ID        string    `json:"id"`
+	RoomID    string    `json:"room"`
+	Inviter   string    `json:"inviter"`
+	Role      string    `json:"role"`
+	MaxUses   int       `json:"max_uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type InviteStore struct {
+	client *redis.Client
+	secret []byte
+}
+
+// NewInviteStore создает хранилище приглашений, подписывающее токены secret
+func NewInviteStore(client *redis.Client, secret []byte) *InviteStore {
+	return &InviteStore{client: client, secret: secret}
+}
+
+// CreateInvite выпускает приглашение в комнату. maxUses = 0 означает
+// неограниченное число подключений до истечения срока
+func (is *InviteStore) CreateInvite(roomID, inviter, role string, ttl time.Duration, maxUses int) (string, *Invite, error) {
+	if ttl == 0 {
+		ttl = DefaultInviteTTL
+	}
+	if ttl < time.Second || ttl > MaxInviteTTL {
+		return "", nil, errors.New("invalid invite ttl: up to 7 days")
+	}
+	if maxUses < 0 || maxUses > maxInviteUses {
+		return "", nil, errors.New("invalid max uses: 0-1000")
+	}
+	if role == "" {
+		role = RoleParticipant
+	}
+	if role != RoleParticipant && role != RoleViewer && role != RoleCoHost {
+		return "", nil, ErrInvalidRole
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	invite := &Invite{
+		ID:        hex.EncodeToString(id),
+		RoomID:    roomID,
+		Inviter:   inviter,
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+	}
+
+	payload, err := json.Marshal(invite)
+	if err != nil {
+		return "", nil, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	token := encoded + "." + base64.RawURLEncoding.EncodeToString(is.sign(encoded))
+
+	return token, invite, nil
+}
+
+// ParseInvite проверяет подпись и срок действия токена, не расходуя его
+func (is *InviteStore) ParseInvite(token string) (*Invite, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidInvite
+	}
+
+	// Strict не допускает разных записей одного и того же токена
+	mac, err := base64.RawURLEncoding.Strict().DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, is.sign(encoded)) {
+		return nil, ErrInvalidInvite
+	}
+
+	payload, err := base64.RawURLEncoding.Strict().DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidInvite
+	}
+
+	var invite Invite
+	if err := json.Unmarshal(payload, &invite); err != nil {
+		return nil, ErrInvalidInvite
+	}
+	if time.Now().After(invite.ExpiresAt) {
+		return nil, ErrInviteExpired
+	}
+
+	return &invite, nil
+}
+
+// RedeemInvite проверяет токен и учитывает одно использование приглашения
+func (is *InviteStore) RedeemInvite(ctx context.Context, token string) (*Invite, error) {
+	invite, err := is.ParseInvite(token)
+	if err != nil {
+		return nil, err
+	}
+	if invite.MaxUses == 0 {
+		return invite, nil
+	}
+
+	key := "invite_uses:" + invite.ID
+	var uses *redis.IntCmd
+	_, err = is.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		uses = pipe.Incr(ctx, key)
+		pipe.ExpireAt(ctx, key, invite.ExpiresAt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if uses.Val() > int64(invite.MaxUses) {
+		return nil, ErrInviteExhausted
+	}
+
+	return invite, nil
+}
+
+func (is *InviteStore) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, is.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// ValidateDisplayName проверяет имя, под которым гость виден в звонке,
+// и возвращает его без пробелов по краям
+func ValidateDisplayName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || !utf8.ValidString(name) || utf8.RuneCountInString(name) > maxDisplayNameLength {
+		return "", ErrInvalidDisplayName
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return "", ErrInvalidDisplayName
+		}
+	}
+	return name, nil
+}
+
+// NewGuestUsername возвращает внутреннее имя гостя. Дефис не допускается в
+// именах учетных записей, поэтому гость не может совпасть с пользователем
+func NewGuestUsername() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return guestUsernamePrefix + hex.EncodeToString(id)
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 )
@@ -11,6 +12,8 @@ type contextKey string
 const (
 	// UsernameContextKey используется для хранения имени пользователя в контексте запроса
 	UsernameContextKey contextKey = "username"
+	// SessionIDContextKey используется для хранения идентификатора сессии в контексте запроса
+	SessionIDContextKey contextKey = "session_id"
 )
 
 // GetUsernameFromContext извлекает имя пользователя из контекста запроса
@@ -19,41 +22,88 @@ func GetUsernameFromContext(ctx context.Context) (string, bool) {
 	return username, ok
 }
 
+// GetSessionIDFromContext извлекает идентификатор сессии из контекста запроса.
+// Он есть только у запросов, аутентифицированных по токену
+func GetSessionIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(SessionIDContextKey).(string)
+	return id, ok
+}
+
+// authRealm - область защиты, сообщаемая клиентам в заголовке WWW-Authenticate
+const authRealm = "meet"
+
+// unauthorized отвечает 401 с вызовами Basic (RFC 7617) и Bearer, чтобы
+// стандартные HTTP-клиенты могли повторить запрос с учетными данными
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Add("WWW-Authenticate", `Basic realm="`+authRealm+`", charset="UTF-8"`)
+	w.Header().Add("WWW-Authenticate", `Bearer realm="`+authRealm+`"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// basicCredentials извлекает имя пользователя и пароль из заголовка Basic.
+// Помимо формата RFC 7617 (base64 от "username:password") поддерживается
+// незакодированный формат "Basic username:password", который использует фронтенд
+func basicCredentials(r *http.Request) (username, password string, ok bool) {
+	if username, password, ok = r.BasicAuth(); ok {
+		return username, password, true
+	}
+
+	scheme, credentials, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+
+	return strings.Cut(credentials, ":")
+}
+
 // AuthMiddleware создает middleware для аутентификации пользователя
-func AuthMiddleware(us *UserStore) func(http.Handler) http.Handler {
+func AuthMiddleware(us *UserStore, ss *SessionStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Получаем токен авторизации из заголовка
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(w, "Не предоставлен токен авторизации", http.StatusUnauthorized)
+				unauthorized(w, "Не предоставлен токен авторизации")
 				return
 			}
 
-			// Извлекаем имя пользователя и пароль из заголовка
-			// Формат: "Basic username:password"
-			if !strings.HasPrefix(authHeader, "Basic ") {
-				http.Error(w, "Неправильный формат токена авторизации", http.StatusUnauthorized)
+			// Формат: "Bearer <токен сессии>"
+			scheme, token, _ := strings.Cut(authHeader, " ")
+			if strings.EqualFold(scheme, "Bearer") {
+				session, err := ss.ValidateSession(r.Context(), token)
+				if errors.Is(err, ErrSessionNotFound) {
+					unauthorized(w, "Сессия не найдена или истекла")
+					return
+				} else if err != nil {
+					http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UsernameContextKey, session.Username)
+				ctx = context.WithValue(ctx, SessionIDContextKey, session.ID)
+
+				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
-			// Разбиваем строку на части и получаем пару username:password
-			parts := strings.SplitN(authHeader[6:], ":", 2)
-			if len(parts) != 2 {
-				http.Error(w, "Неправильный формат токена авторизации", http.StatusUnauthorized)
+			// Формат: "Basic base64(username:password)" или "Basic username:password"
+			username, password, ok := basicCredentials(r)
+			if !ok {
+				unauthorized(w, "Неправильный формат токена авторизации")
 				return
 			}
 
-			username, password := parts[0], parts[1]
-
 			// Проверяем валидность учетных данных
 			valid, err := us.ValidateUser(r.Context(), username, password)
-			if err != nil {
+			if errors.Is(err, ErrInvalidUsername) || errors.Is(err, ErrInvalidPassword) {
+				unauthorized(w, "Неверные учетные данные")
+				return
+			} else if err != nil {
 				http.Error(w, "Внутренняя ошибка сервера", http.StatusInternalServerError)
 				return
 			}
 			if !valid {
-				http.Error(w, "Неверные учетные данные", http.StatusUnauthorized)
+				unauthorized(w, "Неверные учетные данные")
 				return
 			}
 
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Роли участников комнаты. Ведущий - всегда владелец комнаты, остальные роли
+// назначаются ведущим и хранятся, пока комната открыта
+const (
+	RoleHost        = "host"
+	RoleCoHost      = "co_host"
+	RoleParticipant = "participant"
+	RoleViewer      = "viewer"
+)
+
+var (
+	ErrInvalidRole  = errors.New("invalid role")
+	ErrInvalidLastN = errors.New("invalid last n: 0-50")
+)
+
+// CanModerate сообщает, может ли роль управлять участниками комнаты
+func CanModerate(role string) bool {
+	return role == RoleHost || role == RoleCoHost
+}
+
+func roomRolesKey(id string) string { return "room:" + id + ":roles" }
+func roomBansKey(id string) string  { return "room:" + id + ":bans" }
+
+// GetRole возвращает роль пользователя в комнате
+func (rs *RoomStore) GetRole(ctx context.Context, room *Room, username string) (string, error) {
+	if username == room.Owner {
+		return RoleHost, nil
+	}
+
+	role, err := rs.client.HGet(ctx, roomRolesKey(room.ID), username).Result()
+	if err == redis.Nil {
+		return RoleParticipant, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+// SetRole назначает пользователю роль в комнате. Роль ведущего назначить нельзя
+func (rs *RoomStore) SetRole(ctx context.Context, roomID, username, role string) error {
+	switch role {
+	case RoleParticipant:
+		return rs.client.HDel(ctx, roomRolesKey(roomID), username).Err()
+	case RoleCoHost, RoleViewer:
+		return rs.client.HSet(ctx, roomRolesKey(roomID), username, role).Err()
+	default:
+		return ErrInvalidRole
+	}
+}
+
+// BanUser запрещает пользователю подключаться к комнате, пока она открыта
+func (rs *RoomStore) BanUser(ctx context.Context, roomID, username string) error {
+	return rs.client.SAdd(ctx, roomBansKey(roomID), username).Err()
+}
+
+// IsBanned проверяет, заблокирован ли пользователь в комнате
+func (rs *RoomStore) IsBanned(ctx context.Context, roomID, username string) (bool, error) {
+	return rs.client.SIsMember(ctx, roomBansKey(roomID), username).Result()
+}
+
+// BanInvite запрещает подключаться к комнате по приглашению. Гость получает
+// новое имя при каждом подключении, поэтому блокировка гостя действует на
+// приглашение, по которому он пришел
+func (rs *RoomStore) BanInvite(ctx context.Context, roomID, inviteID string) error {
+	return rs.client.SAdd(ctx, roomBansKey(roomID), inviteBanMember(inviteID)).Err()
+}
+
+// IsInviteBanned проверяет, заблокировано ли приглашение в комнате
+func (rs *RoomStore) IsInviteBanned(ctx context.Context, roomID, inviteID string) (bool, error) {
+	return rs.client.SIsMember(ctx, roomBansKey(roomID), inviteBanMember(inviteID)).Result()
+}
+
+// inviteBanMember не пересекается с именами пользователей: в них нет двоеточия
+func inviteBanMember(inviteID string) string { return "invite:" + inviteID }
+
+// SetLocked закрывает комнату для новых подключений или открывает ее снова.
+// Ведущие могут подключаться к запертой комнате
+func (rs *RoomStore) SetLocked(ctx context.Context, id string, locked bool) (*Room, error) {
+	return rs.updateRoom(ctx, id, func(room *Room) { room.Locked = locked })
+}
+
+// SetLobby включает зал ожидания: участники попадают в комнату только после
+// того, как их впустит ведущий или соведущий
+func (rs *RoomStore) SetLobby(ctx context.Context, id string, enabled bool) (*Room, error) {
+	return rs.updateRoom(ctx, id, func(room *Room) { room.Lobby = enabled })
+}
+
+// SetLastN задает, видео скольких недавних докладчиков получает каждый
+// участник комнаты. 0 отключает ограничение
+func (rs *RoomStore) SetLastN(ctx context.Context, id string, n int) (*Room, error) {
+	if n < 0 || n > maxRoomParticipants {
+		return nil, ErrInvalidLastN
+	}
+	return rs.updateRoom(ctx, id, func(room *Room) { room.LastN = n })
+}
+
+func (rs *RoomStore) updateRoom(ctx context.Context, id string, update func(room *Room)) (*Room, error) {
+	return rs.updateOpenRoom(ctx, id, func(_ redis.Pipeliner, room *Room) { update(room) })
+}
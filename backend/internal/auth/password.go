@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Параметры argon2id (рекомендация OWASP: 19 MiB памяти, 2 итерации, 1 поток)
+const (
+	argon2Memory  uint32 = 19 * 1024
+	argon2Time    uint32 = 2
+	argon2Threads uint8  = 1
+	argon2SaltLen        = 16
+	argon2KeyLen  uint32 = 32
+
+	argon2Prefix = "$argon2id$"
+)
+
+var errInvalidHash = errors.New("invalid password hash format")
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+var currentArgon2Params = argon2Params{
+	memory:  argon2Memory,
+	time:    argon2Time,
+	threads: argon2Threads,
+}
+
+// hashPassword возвращает argon2id-хеш пароля со случайной солью в формате PHC:
+// $argon2id$v=19$m=...,t=...,p=...$<соль>$<хеш>
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := currentArgon2Params
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, argon2KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix, argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// isPasswordHash сообщает, хранится ли пароль в виде хеша, а не открытым текстом
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, argon2Prefix)
+}
+
+// verifyPassword сравнивает пароль с сохраненным значением за постоянное время.
+// needsRehash равен true, если значение хранится открытым текстом или
+// захешировано с устаревшими параметрами
+func verifyPassword(password, stored string) (ok, needsRehash bool) {
+	p, salt, key, err := decodePasswordHash(stored)
+	if err != nil {
+		// Значение не разбирается как хеш - это пароль, сохраненный открытым
+		// текстом до внедрения хеширования (в том числе начинающийся с "$argon2id$")
+		ok = subtle.ConstantTimeCompare([]byte(password), []byte(stored)) == 1
+		return ok, true
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	ok = subtle.ConstantTimeCompare(candidate, key) == 1
+
+	return ok, p != currentArgon2Params
+}
+
+func decodePasswordHash(stored string) (p argon2Params, salt, key []byte, err error) {
+	if !isPasswordHash(stored) {
+		return p, nil, nil, errInvalidHash
+	}
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", соль, хеш
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	if p.memory == 0 || p.time == 0 || p.threads == 0 {
+		return p, nil, nil, errInvalidHash
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, errInvalidHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return p, nil, nil, errInvalidHash
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RecordingRef указывает на запись в хранилище записей
+type RecordingRef struct {
+	RoomID string
+	ID     string
+}
+
+// RecordingIndex хранит для каждого пользователя записи, к которым у него есть
+// доступ, чтобы список записей не требовал обхода всего хранилища
+type RecordingIndex struct {
+	client *redis.Client
+}
+
+func NewRecordingIndex(client *redis.Client) *RecordingIndex {
+	return &RecordingIndex{client: client}
+}
+
+func recordingIndexKey(username string) string { return "recordings:" + username }
+
+// AddRecording добавляет запись в списки пользователей usernames. Гостей
+// пропускаем: войти и посмотреть свои записи они не могут
+func (ri *RecordingIndex) AddRecording(ctx context.Context, roomID, id string, startedAt time.Time, usernames []string) error {
+	member := roomID + "/" + id
+	_, err := ri.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, username := range usernames {
+			if !usernameRegex.MatchString(username) {
+				continue
+			}
+			pipe.ZAdd(ctx, recordingIndexKey(username), redis.Z{Score: float64(startedAt.Unix()), Member: member})
+		}
+		return nil
+	})
+	return err
+}
+
+// RemoveRecording убирает запись из списков пользователей usernames
+func (ri *RecordingIndex) RemoveRecording(ctx context.Context, roomID, id string, usernames []string) error {
+	member := roomID + "/" + id
+	_, err := ri.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, username := range usernames {
+			pipe.ZRem(ctx, recordingIndexKey(username), member)
+		}
+		return nil
+	})
+	return err
+}
+
+// ListRecordings возвращает записи пользователя, начиная с самых новых.
+// Непустой roomID ограничивает список одной комнатой
+func (ri *RecordingIndex) ListRecordings(ctx context.Context, username, roomID string) ([]RecordingRef, error) {
+	members, err := ri.client.ZRevRange(ctx, recordingIndexKey(username), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]RecordingRef, 0, len(members))
+	for _, member := range members {
+		room, id, ok := strings.Cut(member, "/")
+		if !ok || (roomID != "" && room != roomID) {
+			continue
+		}
+		refs = append(refs, RecordingRef{RoomID: room, ID: id})
+	}
+
+	return refs, nil
+}
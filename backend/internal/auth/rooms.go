@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	RoomStatusOpen   = "open"
+	RoomStatusClosed = "closed"
+
+	maxRoomTitleLength      = 128
+	maxRoomParticipants     = 50
+	defaultRoomParticipants = 10
+	maxRoomUpdateRetries    = 10
+)
+
+var (
+	ErrRoomNotFound = errors.New("room not found")
+	ErrRoomClosed   = errors.New("room is closed")
+)
+
+type Room struct {
+	ID              string     `json:"id"`
+	Title           string     `json:"title"`
+	Owner           string     `json:"owner"`
+	MaxParticipants int        `json:"max_participants"`
+	Status          string     `json:"status"`
+	Locked          bool       `json:"locked"`
+	Lobby           bool       `json:"lobby"`
+	LastN           int        `json:"last_n"` // Сколько недавних докладчиков присылают видео; 0 - все
+	CreatedAt       time.Time  `json:"created_at"`
+	ClosedAt        *time.Time `json:"closed_at,omitempty"`
+}
+
+type RoomStore struct {
+	client *redis.Client
+}
+
+func NewRoomStore(client *redis.Client) *RoomStore {
+	return &RoomStore{client: client}
+}
+
+// CreateRoom создает новую комнату, владельцем которой становится owner
+func (rs *RoomStore) CreateRoom(ctx context.Context, owner, title string, maxParticipants int) (*Room, error) {
+	if owner == "" {
+		return nil, errors.New("room owner is required")
+	}
+	if title == "" || utf8.RuneCountInString(title) > maxRoomTitleLength || !utf8.ValidString(title) {
+		return nil, errors.New("invalid title: 1-128 chars")
+	}
+	if maxParticipants == 0 {
+		maxParticipants = defaultRoomParticipants
+	}
+	if maxParticipants < 2 || maxParticipants > maxRoomParticipants {
+		return nil, errors.New("invalid max participants: 2-50")
+	}
+
+	id, err := newRoomID()
+	if err != nil {
+		return nil, err
+	}
+
+	room := &Room{
+		ID:              id,
+		Title:           title,
+		Owner:           owner,
+		MaxParticipants: maxParticipants,
+		Status:          RoomStatusOpen,
+		CreatedAt:       time.Now(),
+	}
+
+	roomJSON, err := json.Marshal(room)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сохраняем комнату и добавляем ее в список комнат владельца одной транзакцией
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "room:"+id, roomJSON, 0)
+		pipe.SAdd(ctx, "rooms:"+owner, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return room, nil
+}
+
+// GetRoom возвращает комнату по идентификатору
+func (rs *RoomStore) GetRoom(ctx context.Context, id string) (*Room, error) {
+	return decodeRoom(rs.client.Get(ctx, "room:"+id).Result())
+}
+
+func decodeRoom(roomJSON string, err error) (*Room, error) {
+	if err == redis.Nil {
+		return nil, ErrRoomNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var room Room
+	if err := json.Unmarshal([]byte(roomJSON), &room); err != nil {
+		return nil, err
+	}
+
+	return &room, nil
+}
+
+// GetOpenRoom возвращает комнату, если она существует и не закрыта
+func (rs *RoomStore) GetOpenRoom(ctx context.Context, id string) (*Room, error) {
+	room, err := rs.GetRoom(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if room.Status == RoomStatusClosed {
+		return nil, ErrRoomClosed
+	}
+
+	return room, nil
+}
+
+// ListRooms возвращает комнаты пользователя, начиная с самых новых
+func (rs *RoomStore) ListRooms(ctx context.Context, owner string) ([]Room, error) {
+	ids, err := rs.client.SMembers(ctx, "rooms:"+owner).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	rooms := make([]Room, 0, len(ids))
+	for _, id := range ids {
+		room, err := rs.GetRoom(ctx, id)
+		if errors.Is(err, ErrRoomNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, *room)
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].CreatedAt.After(rooms[j].CreatedAt)
+	})
+
+	return rooms, nil
+}
+
+// CloseRoom помечает комнату закрытой. Подключение к закрытой комнате невозможно
+func (rs *RoomStore) CloseRoom(ctx context.Context, id string) (*Room, error) {
+	return rs.updateOpenRoom(ctx, id, func(pipe redis.Pipeliner, room *Room) {
+		closedAt := time.Now()
+		room.Status = RoomStatusClosed
+		room.ClosedAt = &closedAt
+		// Роли и блокировки действуют только пока комната открыта
+		pipe.Del(ctx, roomRolesKey(id), roomBansKey(id))
+	})
+}
+
+// updateOpenRoom читает открытую комнату, применяет к ней update и сохраняет
+// результат. Запись идет через WATCH/MULTI: если комнату успели изменить
+// между чтением и записью, попытка повторяется, чтобы не потерять чужое
+// изменение и не открыть заново уже закрытую комнату. update может добавить
+// в транзакцию свои команды через pipe
+func (rs *RoomStore) updateOpenRoom(ctx context.Context, id string, update func(pipe redis.Pipeliner, room *Room)) (*Room, error) {
+	key := "room:" + id
+
+	var room *Room
+	txf := func(tx *redis.Tx) error {
+		var err error
+		room, err = decodeRoom(tx.Get(ctx, key).Result())
+		if err != nil {
+			return err
+		}
+		if room.Status == RoomStatusClosed {
+			return ErrRoomClosed
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			update(pipe, room)
+			roomJSON, err := json.Marshal(room)
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, key, roomJSON, 0)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt < maxRoomUpdateRetries; attempt++ {
+		err = rs.client.Watch(ctx, txf, key)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return room, nil
+}
+
+func newRoomID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
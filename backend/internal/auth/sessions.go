@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultSessionTTL - время жизни сессии по умолчанию
+const DefaultSessionTTL = 24 * time.Hour
+
+var ErrSessionNotFound = errors.New("session not found or expired")
+
+// Session описывает активную сессию пользователя. Сам токен в Redis не хранится:
+// идентификатором сессии служит SHA-256 от токена
+type Session struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+type SessionStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewSessionStore(client *redis.Client, ttl time.Duration) *SessionStore {
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	return &SessionStore{client: client, ttl: ttl}
+}
+
+// CreateSession создает сессию пользователя и возвращает ее токен
+func (ss *SessionStore) CreateSession(ctx context.Context, username, ip, userAgent string) (string, *Session, error) {
+	if !usernameRegex.MatchString(username) {
+		return "", nil, ErrInvalidUsername
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	session := &Session{
+		ID:        sessionID(token),
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ss.ttl),
+		IP:        ip,
+		UserAgent: userAgent,
+	}
+
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Истекшие сессии убираем из списка пользователя здесь, а не только в
+	// ListSessions: иначе список растет с каждым входом
+	expired, err := ss.client.ZRangeByScore(ctx, sessionExpiryKey(username), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = ss.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, "session:"+session.ID, sessionJSON, ss.ttl)
+		if len(expired) > 0 {
+			pipe.SRem(ctx, "sessions:"+username, expired)
+		}
+		pipe.SAdd(ctx, "sessions:"+username, session.ID)
+		// Сроки действия сессий пользователя: по ним HasActiveSession отвечает
+		// одним запросом. Новая сессия истекает последней, поэтому вместе с ней
+		// истекают и оба ключа
+		pipe.ZAdd(ctx, sessionExpiryKey(username), redis.Z{Score: float64(session.ExpiresAt.Unix()), Member: session.ID})
+		pipe.ZRemRangeByScore(ctx, sessionExpiryKey(username), "-inf", strconv.FormatInt(now.Unix(), 10))
+		pipe.Expire(ctx, "sessions:"+username, ss.ttl)
+		pipe.Expire(ctx, sessionExpiryKey(username), ss.ttl)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, session, nil
+}
+
+// ValidateSession возвращает сессию по ее токену
+func (ss *SessionStore) ValidateSession(ctx context.Context, token string) (*Session, error) {
+	if token == "" {
+		return nil, ErrSessionNotFound
+	}
+	return ss.getSession(ctx, sessionID(token))
+}
+
+// ListSessions возвращает активные сессии пользователя, начиная с самых новых.
+// Истекшие сессии удаляются из списка
+func (ss *SessionStore) ListSessions(ctx context.Context, username string) ([]Session, error) {
+	ids, err := ss.client.SMembers(ctx, "sessions:"+username).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(ids))
+	for _, id := range ids {
+		session, err := ss.getSession(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			ss.client.SRem(ctx, "sessions:"+username, id)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+// HasActiveSession сообщает, есть ли у пользователя хотя бы одна активная сессия.
+// Проверка выполняется одним запросом к Redis, поэтому ее можно вызывать
+// на каждое сообщение TURN
+func (ss *SessionStore) HasActiveSession(ctx context.Context, username string) (bool, error) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	count, err := ss.client.ZCount(ctx, sessionExpiryKey(username), "("+now, "+inf").Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// RevokeSession завершает сессию пользователя по ее идентификатору
+func (ss *SessionStore) RevokeSession(ctx context.Context, username, id string) error {
+	session, err := ss.getSession(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session.Username != username {
+		return ErrSessionNotFound
+	}
+
+	_, err = ss.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, "session:"+id)
+		pipe.SRem(ctx, "sessions:"+username, id)
+		pipe.ZRem(ctx, sessionExpiryKey(username), id)
+		return nil
+	})
+	return err
+}
+
+func (ss *SessionStore) getSession(ctx context.Context, id string) (*Session, error) {
+	sessionJSON, err := ss.client.Get(ctx, "session:"+id).Result()
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal([]byte(sessionJSON), &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func sessionExpiryKey(username string) string { return "sessions:" + username + ":expiry" }
+
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"errors"
+	"log"
 	"regexp"
 
 	"github.com/redis/go-redis/v9"
@@ -11,6 +12,9 @@ import (
 var (
 	usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9]{4,32}$`)
 	passwordRegex = regexp.MustCompile(`^[a-zA-Z0-9!@#$%^&*()_+\-=\[\]{}|;:,.<>?/]{4,32}$`)
+
+	ErrInvalidUsername = errors.New("invalid username: only latin letters and digits, 4-32 chars")
+	ErrInvalidPassword = errors.New("invalid password: only latin letters, digits and special chars (!@#$%^&*()_+-=[]{}|;:,.<>?/), 4-32 chars")
 )
 
 type UserStore struct {
@@ -23,10 +27,10 @@ func NewUserStore(client *redis.Client) *UserStore {
 
 func (us *UserStore) CreateUser(ctx context.Context, username, password string) error {
 	if !usernameRegex.MatchString(username) {
-		return errors.New("invalid username: only latin letters and digits, 4-32 chars")
+		return ErrInvalidUsername
 	}
 	if !passwordRegex.MatchString(password) {
-		return errors.New("invalid password: only latin letters, digits and special chars (!@#$%^&*()_+-=[]{}|;:,.<>?/), 4-32 chars")
+		return ErrInvalidPassword
 	}
 	key := "user:" + username
 	exists, err := us.client.Exists(ctx, key).Result()
@@ -36,15 +40,19 @@ func (us *UserStore) CreateUser(ctx context.Context, username, password string)
 	if exists == 1 {
 		return errors.New("user already exists")
 	}
-	return us.client.Set(ctx, key, password, 0).Err()
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return us.client.Set(ctx, key, hash, 0).Err()
 }
 
 func (us *UserStore) ValidateUser(ctx context.Context, username, password string) (bool, error) {
 	if !usernameRegex.MatchString(username) {
-		return false, errors.New("invalid username: only latin letters and digits, 4-32 chars")
+		return false, ErrInvalidUsername
 	}
 	if !passwordRegex.MatchString(password) {
-		return false, errors.New("invalid password: only latin letters, digits and special chars (!@#$%^&*()_+-=[]{}|;:,.<>?/), 4-32 chars")
+		return false, ErrInvalidPassword
 	}
 	key := "user:" + username
 	storedPassword, err := us.client.Get(ctx, key).Result()
@@ -53,5 +61,39 @@ func (us *UserStore) ValidateUser(ctx context.Context, username, password string
 	} else if err != nil {
 		return false, err
 	}
-	return storedPassword == password, nil
+	valid, needsRehash := verifyPassword(password, storedPassword)
+	if !valid {
+		return false, nil
+	}
+	if needsRehash {
+		// Пароль хранится открытым текстом или с устаревшими параметрами -
+		// перехешируем его после успешного входа
+		if err := us.rehashPassword(ctx, key, storedPassword, password); err != nil {
+			log.Printf("Ошибка при перехешировании пароля пользователя %s: %v", username, err)
+		}
+	}
+	return true, nil
+}
+
+// rehashPassword заменяет сохраненное значение пароля новым хешем,
+// если оно не изменилось с момента проверки
+func (us *UserStore) rehashPassword(ctx context.Context, key, storedPassword, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return us.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if current != storedPassword {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, hash, 0)
+			return nil
+		})
+		return err
+	}, key)
 }
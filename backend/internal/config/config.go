@@ -0,0 +1,338 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/ice"
+	"github.com/Coderovshik/meet/internal/logging"
+	"github.com/Coderovshik/meet/internal/origin"
+	"github.com/Coderovshik/meet/internal/recording"
+	"github.com/Coderovshik/meet/internal/turnserver"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config - конфигурация сервера. Значения применяются в порядке:
+// значения по умолчанию, YAML-файл, переменные окружения, флаги командной строки
+type Config struct {
+	ListenAddr      string            `yaml:"listen_addr"`
+	StaticDir       string            `yaml:"static_dir"`
+	LogLevel        string            `yaml:"log_level"`
+	AllowedOrigins  []string          `yaml:"allowed_origins"`
+	SessionTTL      time.Duration     `yaml:"session_ttl"`
+	WSQueryPassword bool              `yaml:"ws_query_password"` // Вход в /ws по username/password из строки запроса
+	ShutdownTimeout time.Duration     `yaml:"shutdown_timeout"`
+	InviteSecret    string            `yaml:"invite_secret"`
+	Redis           RedisConfig       `yaml:"redis"`
+	ICE             ice.Config        `yaml:"ice"`
+	TURN            turnserver.Config `yaml:"turn"`
+	Recording       recording.Config  `yaml:"recording"`
+
+	// Warnings - замечания к конфигурации, с которыми сервер все же может
+	// работать. Выводятся при запуске
+	Warnings []string `yaml:"-"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	TLS      bool   `yaml:"tls"`
+}
+
+// Default возвращает конфигурацию, с которой сервер работал до появления файла настроек
+func Default() Config {
+	return Config{
+		ListenAddr:      ":8080",
+		StaticDir:       "./web",
+		LogLevel:        "info",
+		SessionTTL:      auth.DefaultSessionTTL,
+		ShutdownTimeout: 15 * time.Second,
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		ICE:       ice.DefaultConfig(),
+		TURN:      turnserver.DefaultConfig(),
+		Recording: recording.DefaultConfig(),
+	}
+}
+
+// Load собирает конфигурацию из файла, окружения и аргументов командной строки.
+// Путь к файлу задается флагом -config или переменной MEET_CONFIG
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("meet", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("MEET_CONFIG"), "path to YAML config file")
+	listenAddr := fs.String("listen", "", "HTTP listen address")
+	staticDir := fs.String("static-dir", "", "directory with frontend files")
+	logLevel := fs.String("log-level", "", "log level: debug, info, warn, error")
+	allowedOrigins := fs.String("allowed-origins", "", "comma-separated list of allowed origins")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 0, "time to drain calls on shutdown")
+	redisAddr := fs.String("redis-addr", "", "Redis address host:port")
+	redisPassword := fs.String("redis-password", "", "Redis password")
+	redisDB := fs.Int("redis-db", 0, "Redis database number")
+	redisTLS := fs.Bool("redis-tls", false, "connect to Redis over TLS")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+
+	// Флаги применяются последними и только если заданы явно
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.ListenAddr = *listenAddr
+		case "static-dir":
+			cfg.StaticDir = *staticDir
+		case "log-level":
+			cfg.LogLevel = *logLevel
+		case "allowed-origins":
+			cfg.AllowedOrigins = splitList(*allowedOrigins)
+		case "shutdown-timeout":
+			cfg.ShutdownTimeout = *shutdownTimeout
+		case "redis-addr":
+			cfg.Redis.Addr = *redisAddr
+		case "redis-password":
+			cfg.Redis.Password = *redisPassword
+		case "redis-db":
+			cfg.Redis.DB = *redisDB
+		case "redis-tls":
+			cfg.Redis.TLS = *redisTLS
+		}
+	})
+
+	if err := cfg.applyEmbeddedTURN(); err != nil {
+		return cfg, err
+	}
+	if cfg.InviteSecret == "" {
+		// Без заданного секрета приглашения перестают действовать после перезапуска
+		secret, err := randomSecret()
+		if err != nil {
+			return cfg, fmt.Errorf("invite: generate secret: %w", err)
+		}
+		cfg.InviteSecret = secret
+		cfg.Warnings = append(cfg.Warnings, "invite_secret не задан: секрет приглашений сгенерирован случайно, "+
+			"выданные приглашения перестанут действовать после перезапуска и не будут приниматься другими экземплярами сервера")
+	}
+	if cfg.Recording.URLSecret == "" {
+		// Без заданного секрета ссылки на записи перестают действовать после перезапуска
+		secret, err := randomSecret()
+		if err != nil {
+			return cfg, fmt.Errorf("recording: generate url secret: %w", err)
+		}
+		cfg.Recording.URLSecret = secret
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if err := c.parseYAML(data); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) parseYAML(data []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// applyEmbeddedTURN раздает клиентам адреса встроенного TURN-сервера, если они
+// не заданы явно, и генерирует общий секрет, если он не задан
+func (c *Config) applyEmbeddedTURN() error {
+	if !c.TURN.Enabled || c.TURN.Validate() != nil {
+		return nil
+	}
+
+	if c.ICE.TURNSecret == "" {
+		secret, err := randomSecret()
+		if err != nil {
+			return fmt.Errorf("turn: generate secret: %w", err)
+		}
+		c.ICE.TURNSecret = secret
+	}
+
+	stunURLs, turnURLs := c.TURN.URLs()
+	if len(c.ICE.TURNURLs) == 0 {
+		c.ICE.TURNURLs = turnURLs
+	}
+	if len(stunURLs) > 0 {
+		c.ICE.Servers = append(c.ICE.Servers, ice.Server{URLs: stunURLs})
+	}
+
+	return nil
+}
+
+// loadEnv применяет переменные окружения. REDIS_HOST оставлен для совместимости
+// с compose.yaml: он задает хост Redis на стандартном порту
+func (c *Config) loadEnv() error {
+	var errs []error
+	lookup := func(name string, apply func(string) error) {
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			if err := apply(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	setString := func(dest *string) func(string) error {
+		return func(v string) error { *dest = v; return nil }
+	}
+	setList := func(dest *[]string) func(string) error {
+		return func(v string) error { *dest = splitList(v); return nil }
+	}
+	setBool := func(dest *bool) func(string) error {
+		return func(v string) (err error) { *dest, err = strconv.ParseBool(v); return err }
+	}
+	setInt := func(dest *int) func(string) error {
+		return func(v string) (err error) { *dest, err = strconv.Atoi(v); return err }
+	}
+	setPort := func(dest *uint16) func(string) error {
+		return func(v string) error {
+			port, err := strconv.ParseUint(v, 10, 16)
+			*dest = uint16(port)
+			return err
+		}
+	}
+	setDuration := func(dest *time.Duration) func(string) error {
+		return func(v string) (err error) { *dest, err = time.ParseDuration(v); return err }
+	}
+
+	lookup("LISTEN_ADDR", setString(&c.ListenAddr))
+	lookup("STATIC_DIR", setString(&c.StaticDir))
+	lookup("LOG_LEVEL", setString(&c.LogLevel))
+	lookup("ALLOWED_ORIGINS", setList(&c.AllowedOrigins))
+	lookup("SESSION_TTL", setDuration(&c.SessionTTL))
+	lookup("WS_QUERY_PASSWORD", setBool(&c.WSQueryPassword))
+	lookup("SHUTDOWN_TIMEOUT", setDuration(&c.ShutdownTimeout))
+	lookup("INVITE_SECRET", setString(&c.InviteSecret))
+
+	lookup("REDIS_HOST", func(v string) error { c.Redis.Addr = net.JoinHostPort(v, "6379"); return nil })
+	lookup("REDIS_ADDR", setString(&c.Redis.Addr))
+	lookup("REDIS_PASSWORD", setString(&c.Redis.Password))
+	lookup("REDIS_DB", setInt(&c.Redis.DB))
+	lookup("REDIS_TLS", setBool(&c.Redis.TLS))
+
+	lookup("ICE_SERVERS", func(v string) error { c.ICE.Servers = []ice.Server{{URLs: splitList(v)}}; return nil })
+	lookup("TURN_URLS", setList(&c.ICE.TURNURLs))
+	lookup("TURN_SECRET", setString(&c.ICE.TURNSecret))
+	lookup("TURN_CREDENTIAL_TTL", setDuration(&c.ICE.TURNCredentialTTL))
+
+	lookup("TURN_ENABLED", setBool(&c.TURN.Enabled))
+	lookup("TURN_REALM", setString(&c.TURN.Realm))
+	lookup("TURN_PUBLIC_IP", setString(&c.TURN.PublicIP))
+	lookup("TURN_LISTEN_ADDR", setString(&c.TURN.ListenAddress))
+	lookup("TURN_UDP_PORT", setInt(&c.TURN.UDPPort))
+	lookup("TURN_TCP_PORT", setInt(&c.TURN.TCPPort))
+	lookup("TURN_RELAY_PORT_MIN", setPort(&c.TURN.RelayMinPort))
+	lookup("TURN_RELAY_PORT_MAX", setPort(&c.TURN.RelayMaxPort))
+
+	lookup("RECORDING_ENABLED", setBool(&c.Recording.Enabled))
+	lookup("RECORDING_SPOOL_DIR", setString(&c.Recording.SpoolDir))
+	lookup("RECORDING_STORAGE", setString(&c.Recording.Storage))
+	lookup("RECORDING_DIR", setString(&c.Recording.Dir))
+	lookup("RECORDING_URL_SECRET", setString(&c.Recording.URLSecret))
+	lookup("RECORDING_URL_TTL", setDuration(&c.Recording.URLTTL))
+	lookup("RECORDING_S3_ENDPOINT", setString(&c.Recording.S3.Endpoint))
+	lookup("RECORDING_S3_REGION", setString(&c.Recording.S3.Region))
+	lookup("RECORDING_S3_BUCKET", setString(&c.Recording.S3.Bucket))
+	lookup("RECORDING_S3_ACCESS_KEY", setString(&c.Recording.S3.AccessKey))
+	lookup("RECORDING_S3_SECRET_KEY", setString(&c.Recording.S3.SecretKey))
+	lookup("RECORDING_S3_PATH_STYLE", setBool(&c.Recording.S3.PathStyle))
+
+	return errors.Join(errs...)
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки сразу
+func (c Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen_addr %q: %w", c.ListenAddr, err))
+	}
+	if info, err := os.Stat(c.StaticDir); err != nil {
+		errs = append(errs, fmt.Errorf("static_dir: %w", err))
+	} else if !info.IsDir() {
+		errs = append(errs, fmt.Errorf("static_dir %q is not a directory", c.StaticDir))
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %w", err))
+	}
+	if _, err := origin.New(c.AllowedOrigins); err != nil {
+		errs = append(errs, fmt.Errorf("allowed_origins: %w", err))
+	}
+	if c.SessionTTL <= 0 {
+		errs = append(errs, errors.New("session_ttl must be positive"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+	if c.InviteSecret != "" && len(c.InviteSecret) < 16 {
+		errs = append(errs, errors.New("invite_secret must be at least 16 characters"))
+	}
+	if _, _, err := net.SplitHostPort(c.Redis.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("redis.addr %q: %w", c.Redis.Addr, err))
+	}
+	if c.Redis.DB < 0 {
+		errs = append(errs, errors.New("redis.db must not be negative"))
+	}
+	if err := c.ICE.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.TURN.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Recording.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func randomSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/Coderovshik/meet/internal/ice"
+)
+
+// FuzzConfigYAML проверяет разбор файла конфигурации с различными входными данными
+func FuzzConfigYAML(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add([]byte("listen_addr: \":9090\"\nlog_level: debug\n"))
+	f.Add([]byte("redis:\n  addr: redis:6379\n  db: 2\n  tls: true\n"))
+	f.Add([]byte("ice:\n  servers:\n    - urls: [\"stun:stun.example.com:3478\"]\n  turn_urls: [\"turn:turn.example.com:3478\"]\n  turn_secret: s3cr3t\n  turn_credential_ttl: 1h\n"))
+	f.Add([]byte("ice:\n  turn_credential_ttl: soon\n"))
+	f.Add([]byte("turn:\n  enabled: true\n  public_ip: 203.0.113.10\n"))
+	f.Add([]byte("unknown_field: 1\n"))
+	f.Add([]byte("allowed_origins: [\"https://*.example.com\"]\n"))
+	f.Add([]byte(""))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cfg := Default()
+		cfg.StaticDir = t.TempDir()
+		if err := cfg.parseYAML(data); err != nil {
+			return
+		}
+		if err := cfg.applyEmbeddedTURN(); err != nil {
+			return
+		}
+		if err := cfg.Validate(); err != nil {
+			return
+		}
+
+		// Корректная конфигурация всегда должна давать список ICE-серверов без паники
+		_, _ = ice.NewProvider(cfg.ICE).Servers("user1")
+	})
+}
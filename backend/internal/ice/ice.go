@@ -0,0 +1,121 @@
+package ice
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// DefaultCredentialTTL - время жизни временных учетных данных TURN по умолчанию
+const DefaultCredentialTTL = 12 * time.Hour
+
+// Server - статически настроенный STUN/TURN сервер
+type Server struct {
+	URLs       []string `yaml:"urls"`
+	Username   string   `yaml:"username"`
+	Credential string   `yaml:"credential"`
+}
+
+// Config описывает ICE-серверы, которые получают и сервер, и клиенты.
+// Если задан TURNSecret, для TURNURLs выдаются временные учетные данные
+// по схеме TURN REST API: username = "<истечение>:<пользователь>",
+// credential = base64(HMAC-SHA1(secret, username))
+type Config struct {
+	Servers           []Server      `yaml:"servers"`
+	TURNURLs          []string      `yaml:"turn_urls"`
+	TURNSecret        string        `yaml:"turn_secret"`
+	TURNCredentialTTL time.Duration `yaml:"turn_credential_ttl"`
+}
+
+// DefaultConfig возвращает конфигурацию с публичным STUN-сервером Google
+func DefaultConfig() Config {
+	return Config{
+		Servers: []Server{
+			{URLs: []string{"stun:stun.l.google.com:19302"}},
+		},
+		TURNCredentialTTL: DefaultCredentialTTL,
+	}
+}
+
+// Validate проверяет согласованность конфигурации
+func (c Config) Validate() error {
+	for _, s := range c.Servers {
+		if len(s.URLs) == 0 {
+			return errors.New("ice: server without urls")
+		}
+	}
+	if len(c.TURNURLs) > 0 && c.TURNSecret == "" {
+		return errors.New("ice: turn_urls require turn_secret")
+	}
+	if c.TURNSecret != "" && len(c.TURNURLs) == 0 {
+		return errors.New("ice: turn_secret is set but turn_urls are empty")
+	}
+	if c.TURNCredentialTTL < 0 {
+		return errors.New("ice: negative turn credential ttl")
+	}
+	return nil
+}
+
+// Provider выдает список ICE-серверов для конкретного пользователя
+type Provider struct {
+	cfg Config
+	now func() time.Time
+}
+
+func NewProvider(cfg Config) *Provider {
+	if cfg.TURNCredentialTTL == 0 {
+		cfg.TURNCredentialTTL = DefaultCredentialTTL
+	}
+	return &Provider{cfg: cfg, now: time.Now}
+}
+
+// Servers возвращает ICE-серверы для пользователя username. Временные
+// учетные данные TURN действительны до момента expiresAt
+func (p *Provider) Servers(username string) (servers []webrtc.ICEServer, expiresAt time.Time) {
+	servers = p.PublicServers()
+
+	if p.cfg.TURNSecret == "" {
+		return servers, time.Time{}
+	}
+
+	expiresAt = p.now().Add(p.cfg.TURNCredentialTTL)
+	turnUsername := strconv.FormatInt(expiresAt.Unix(), 10) + ":" + username
+	servers = append(servers, webrtc.ICEServer{
+		URLs:           p.cfg.TURNURLs,
+		Username:       turnUsername,
+		Credential:     TURNPassword(p.cfg.TURNSecret, turnUsername),
+		CredentialType: webrtc.ICECredentialTypePassword,
+	})
+
+	return servers, expiresAt
+}
+
+// PublicServers возвращает ICE-серверы без временных учетных данных TURN.
+// Их получают пользователи без сессии: встроенный TURN-сервер все равно
+// отклонил бы выданные им учетные данные
+func (p *Provider) PublicServers() []webrtc.ICEServer {
+	servers := make([]webrtc.ICEServer, 0, len(p.cfg.Servers)+1)
+	for _, s := range p.cfg.Servers {
+		server := webrtc.ICEServer{URLs: s.URLs}
+		if s.Username != "" {
+			server.Username = s.Username
+			server.Credential = s.Credential
+			server.CredentialType = webrtc.ICECredentialTypePassword
+		}
+		servers = append(servers, server)
+	}
+
+	return servers
+}
+
+// TURNPassword вычисляет пароль TURN REST API для временного имени пользователя
+func TURNPassword(secret, turnUsername string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(turnUsername))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,45 @@
+package ice
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// FuzzTURNCredentials проверяет формат временных учетных данных TURN REST API
+func FuzzTURNCredentials(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("user1", "s3cr3t", int64(3600))
+	f.Add("", "s3cr3t", int64(1))
+	f.Add("user:1", "", int64(0))
+	f.Add(string([]byte{0xff, 0xfe}), "s3cr3t", int64(-1)) // Невалидные UTF-8 байты
+
+	f.Fuzz(func(t *testing.T, username, secret string, ttlSeconds int64) {
+		if secret == "" || ttlSeconds <= 0 || ttlSeconds > 365*24*3600 {
+			return
+		}
+
+		now := time.Unix(1700000000, 0)
+		p := NewProvider(Config{
+			TURNURLs:          []string{"turn:turn.example.com:3478"},
+			TURNSecret:        secret,
+			TURNCredentialTTL: time.Duration(ttlSeconds) * time.Second,
+		})
+		p.now = func() time.Time { return now }
+
+		servers, expiresAt := p.Servers(username)
+		if len(servers) != 1 {
+			t.Fatalf("Ожидался один TURN-сервер, получено %d", len(servers))
+		}
+
+		// Имя пользователя TURN: "<unix-время истечения>:<пользователь>"
+		expiry, user, ok := strings.Cut(servers[0].Username, ":")
+		if !ok || user != username || expiry != strconv.FormatInt(expiresAt.Unix(), 10) {
+			t.Errorf("Некорректное имя пользователя TURN %q", servers[0].Username)
+		}
+		if servers[0].Credential != TURNPassword(secret, servers[0].Username) {
+			t.Errorf("Пароль TURN не совпадает с HMAC от имени пользователя")
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level - уровень детализации журнала приложения
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var current atomic.Int32
+
+func init() {
+	current.Store(int32(LevelInfo))
+}
+
+// ParseLevel разбирает название уровня: debug, info, warn или error
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// SetLevel задает минимальный уровень сообщений, попадающих в журнал
+func SetLevel(level Level) {
+	current.Store(int32(level))
+}
+
+func logf(level Level, format string, v ...any) {
+	if Level(current.Load()) > level {
+		return
+	}
+	log.Output(3, fmt.Sprintf(format, v...))
+}
+
+func Debugf(format string, v ...any) { logf(LevelDebug, format, v...) }
+func Infof(format string, v ...any)  { logf(LevelInfo, format, v...) }
+func Warnf(format string, v ...any)  { logf(LevelWarn, format, v...) }
+func Errorf(format string, v ...any) { logf(LevelError, format, v...) }
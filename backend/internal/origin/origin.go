@@ -0,0 +1,93 @@
+package origin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Allowlist решает, с каких сайтов браузер может обращаться к серверу.
+// Шаблон "https://*.example.com" разрешает любые поддомены example.com,
+// но не сам example.com. Запросы с того же хоста, что и сервер, и запросы
+// без заголовка Origin (не из браузера) разрешены всегда
+type Allowlist struct {
+	exact     map[string]struct{}
+	wildcards []wildcard
+}
+
+type wildcard struct {
+	scheme string
+	suffix string
+}
+
+// New разбирает список шаблонов вида "scheme://host[:port]"
+func New(patterns []string) (*Allowlist, error) {
+	a := &Allowlist{exact: make(map[string]struct{}, len(patterns))}
+	for _, pattern := range patterns {
+		scheme, host, err := parse(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("origin %q: %w", pattern, err)
+		}
+
+		if suffix, ok := strings.CutPrefix(host, "*"); ok {
+			if !strings.HasPrefix(suffix, ".") || strings.Contains(suffix, "*") {
+				return nil, fmt.Errorf("origin %q: wildcard must be a whole leftmost label", pattern)
+			}
+			a.wildcards = append(a.wildcards, wildcard{scheme: scheme, suffix: suffix})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("origin %q: wildcard must be a whole leftmost label", pattern)
+		}
+		a.exact[scheme+"://"+host] = struct{}{}
+	}
+	return a, nil
+}
+
+// Allowed сообщает, разрешен ли запрос с заголовком Origin из r
+func (a *Allowlist) Allowed(r *http.Request) bool {
+	value := r.Header.Get("Origin")
+	if value == "" {
+		return true
+	}
+
+	scheme, host, err := parse(value)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, r.Host) {
+		return true
+	}
+
+	return a.match(scheme, host)
+}
+
+func (a *Allowlist) match(scheme, host string) bool {
+	if _, ok := a.exact[scheme+"://"+host]; ok {
+		return true
+	}
+	for _, w := range a.wildcards {
+		if w.scheme == scheme && len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parse возвращает схему и хост с портом в нижнем регистре. Путь, запрос и
+// учетные данные в Origin не допускаются
+func parse(value string) (scheme, host string, err error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", "", err
+	}
+	scheme = strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return "", "", fmt.Errorf("must be scheme://host[:port]")
+	}
+	return scheme, strings.ToLower(u.Host), nil
+}
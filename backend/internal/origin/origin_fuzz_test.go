@@ -0,0 +1,46 @@
+package origin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// FuzzAllowlist проверяет, что шаблон с поддоменами не пропускает чужие сайты
+func FuzzAllowlist(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("https://meet.example.com")
+	f.Add("https://example.com")
+	f.Add("https://evil-example.com")
+	f.Add("https://example.com.evil.org")
+	f.Add("http://a.example.com")
+	f.Add("https://a.b.example.com:8443")
+	f.Add("null")
+	f.Add(string([]byte{0xff, 0xfe})) // Невалидные UTF-8 байты
+
+	allowlist, err := New([]string{"https://*.example.com", "https://app.test:8443"})
+	if err != nil {
+		f.Fatalf("Не удалось разобрать шаблоны: %v", err)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		r := httptest.NewRequest("GET", "http://server.local/ws", nil)
+		r.Header.Set("Origin", value)
+
+		// Запросы без Origin приходят не из браузера и разрешены всегда
+		if !allowlist.Allowed(r) || value == "" {
+			return
+		}
+
+		scheme, host, err := parse(value)
+		if err != nil {
+			t.Fatalf("Разрешен некорректный Origin %q", value)
+		}
+		if host == "server.local" || (scheme == "https" && host == "app.test:8443") {
+			return
+		}
+		if scheme != "https" || !strings.HasSuffix(host, ".example.com") || host == ".example.com" {
+			t.Errorf("Разрешен Origin %q, не подходящий под шаблоны", value)
+		}
+	})
+}
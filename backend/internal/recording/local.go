@@ -0,0 +1,213 @@
+package recording
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalURLPrefix - путь, по которому сервер отдает файлы локального хранилища
+// по подписанным ссылкам
+const LocalURLPrefix = "/api/recording-files/"
+
+var (
+	ErrInvalidSignature = errors.New("recording: invalid signature")
+	ErrURLExpired       = errors.New("recording: url expired")
+)
+
+// LocalStore хранит записи в каталоге на диске. Подписанные ссылки ведут на
+// сам сервер и проверяются методом Verify
+type LocalStore struct {
+	dir       string
+	secret    []byte
+	urlPrefix string
+	now       func() time.Time
+}
+
+// NewLocalStore создает хранилище в каталоге dir. Ссылки на файлы
+// подписываются secret и начинаются с urlPrefix
+func NewLocalStore(dir string, secret []byte, urlPrefix string) (*LocalStore, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("recording: url secret is required")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+
+	return &LocalStore{dir: dir, secret: secret, urlPrefix: urlPrefix, now: time.Now}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put записывает файл через временный файл, чтобы читатели не увидели его
+// недописанным
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	dest, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o750); err != nil {
+		return fmt.Errorf("recording: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("recording: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("recording: %w", err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("recording: wrote %d bytes of %d", written, size)
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+
+	if info, err := file.Stat(); err != nil || info.IsDir() {
+		file.Close()
+		return nil, ErrNotFound
+	}
+
+	return file, nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	if !validPrefix(prefix) {
+		return nil, ErrInvalidKey
+	}
+
+	objects := []Object{}
+	err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+
+	return objects, nil
+}
+
+// Delete удаляет файл и опустевшие каталоги записи и комнаты
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("recording: %w", err)
+	}
+
+	for dir := filepath.Dir(path); dir != filepath.Clean(s.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// SignedURL возвращает ссылку вида <prefix><key>?expires=<unix>&signature=<hmac>
+func (s *LocalStore) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	if ttl <= 0 {
+		ttl = DefaultURLTTL
+	}
+
+	expires := strconv.FormatInt(s.now().Add(ttl).Unix(), 10)
+	query := url.Values{"expires": {expires}, "signature": {s.sign(key, expires)}}
+
+	return s.urlPrefix + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+// Verify проверяет подпись и срок действия ссылки, выданной SignedURL
+func (s *LocalStore) Verify(key, expires, signature string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	mac, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.signature(key, expires)) {
+		return ErrInvalidSignature
+	}
+
+	deadline, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if s.now().Unix() > deadline {
+		return ErrURLExpired
+	}
+
+	return nil
+}
+
+func (s *LocalStore) sign(key, expires string) string {
+	return hex.EncodeToString(s.signature(key, expires))
+}
+
+func (s *LocalStore) signature(key, expires string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return mac.Sum(nil)
+}
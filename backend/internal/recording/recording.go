@@ -0,0 +1,439 @@
+package recording
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+// ManifestFile - имя файла с описанием записи внутри ее каталога
+const ManifestFile = "manifest.json"
+
+var (
+	ErrDisabled         = errors.New("recording: disabled")
+	ErrUnsupportedCodec = errors.New("recording: unsupported codec")
+	ErrStopped          = errors.New("recording: stopped")
+)
+
+// Config - настройки записи звонков. Запись выключена, пока не задан Enabled;
+// уже сохраненные записи доступны и без него
+type Config struct {
+	Enabled bool `yaml:"enabled"`
+	// SpoolDir - каталог для файлов идущих записей: запись пишется в
+	// <spool_dir>/<комната>/<запись> и после остановки переносится в хранилище
+	SpoolDir string `yaml:"spool_dir"`
+	// Storage - хранилище завершенных записей: local или s3
+	Storage string `yaml:"storage"`
+	// Dir - каталог хранилища local
+	Dir string `yaml:"dir"`
+	// URLSecret подписывает ссылки на файлы хранилища local
+	URLSecret string `yaml:"url_secret"`
+	// URLTTL - срок действия ссылок на скачивание файлов
+	URLTTL time.Duration `yaml:"url_ttl"`
+	S3     S3Config      `yaml:"s3"`
+}
+
+// DefaultConfig возвращает конфигурацию с выключенной записью и локальным хранилищем
+func DefaultConfig() Config {
+	return Config{
+		SpoolDir: "./recordings/spool",
+		Storage:  StorageLocal,
+		Dir:      "./recordings/archive",
+		URLTTL:   DefaultURLTTL,
+	}
+}
+
+// Validate проверяет согласованность конфигурации
+func (c Config) Validate() error {
+	if c.Enabled && strings.TrimSpace(c.SpoolDir) == "" {
+		return errors.New("recording: spool_dir is required")
+	}
+	if c.URLTTL <= 0 || c.URLTTL > s3MaxPresignTime {
+		return errors.New("recording: url_ttl must be between 1s and 168h")
+	}
+	switch c.Storage {
+	case StorageLocal:
+		if strings.TrimSpace(c.Dir) == "" {
+			return errors.New("recording: dir is required for local storage")
+		}
+		if c.SpoolDir != "" && filepath.Clean(c.SpoolDir) == filepath.Clean(c.Dir) {
+			return errors.New("recording: spool_dir and dir must differ")
+		}
+	case StorageS3:
+		return c.S3.Validate()
+	default:
+		return fmt.Errorf("recording: unknown storage %q", c.Storage)
+	}
+	return nil
+}
+
+// Manifest описывает запись. Смещения указаны в миллисекундах от начала записи
+type Manifest struct {
+	ID           string        `json:"id"`
+	RoomID       string        `json:"room_id"`
+	Host         string        `json:"host"` // Ведущий комнаты на момент записи, он управляет записью
+	StartedBy    string        `json:"started_by"`
+	StartedAt    time.Time     `json:"started_at"`
+	EndedAt      time.Time     `json:"ended_at"`
+	Participants []Participant `json:"participants"`
+	Tracks       []TrackInfo   `json:"tracks"`
+}
+
+// Usernames возвращает без повторов пользователей, которым доступна запись:
+// ведущего, включившего запись и участников
+func (m *Manifest) Usernames() []string {
+	usernames := []string{}
+	add := func(username string) {
+		if username != "" && !slices.Contains(usernames, username) {
+			usernames = append(usernames, username)
+		}
+	}
+
+	add(m.Host)
+	add(m.StartedBy)
+	for _, participant := range m.Participants {
+		add(participant.Username)
+	}
+
+	return usernames
+}
+
+// Participant - участник, находившийся в комнате во время записи
+type Participant struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	JoinOffset  int64  `json:"join_offset_ms"`
+	LeaveOffset int64  `json:"leave_offset_ms"`
+}
+
+// TrackInfo - файл одной дорожки участника
+type TrackInfo struct {
+	ParticipantID string `json:"participant_id"`
+	TrackID       string `json:"track_id"`
+	Kind          string `json:"kind"`
+	Codec         string `json:"codec"`
+	File          string `json:"file"`
+	StartOffset   int64  `json:"start_offset_ms"`
+	EndOffset     int64  `json:"end_offset_ms"`
+}
+
+// Recorder пишет дорожки одной комнаты в отдельный каталог и по окончании
+// сохраняет manifest.json
+type Recorder struct {
+	dir string
+
+	mu       sync.Mutex
+	manifest Manifest
+	// present - индексы участников в manifest.Participants, еще не покинувших комнату
+	present map[string]int
+	tracks  []*Track
+	stopped bool
+}
+
+// Start создает каталог записи и начинает отсчет смещений. host - ведущий
+// комнаты, startedBy - кто включил запись
+func Start(cfg Config, roomID, host, startedBy string) (*Recorder, error) {
+	if !cfg.Enabled {
+		return nil, ErrDisabled
+	}
+	if roomID == "" || roomID != filepath.Base(roomID) {
+		return nil, fmt.Errorf("recording: invalid room id %q", roomID)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("recording: generate id: %w", err)
+	}
+	startedAt := time.Now().UTC()
+	id := startedAt.Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+
+	dir := filepath.Join(cfg.SpoolDir, roomID, id)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+
+	return &Recorder{
+		dir: dir,
+		manifest: Manifest{
+			ID:           id,
+			RoomID:       roomID,
+			Host:         host,
+			StartedBy:    startedBy,
+			StartedAt:    startedAt,
+			Participants: []Participant{},
+			Tracks:       []TrackInfo{},
+		},
+		present: map[string]int{},
+	}, nil
+}
+
+// ID возвращает идентификатор записи
+func (r *Recorder) ID() string {
+	return r.manifest.ID
+}
+
+// Dir возвращает каталог с файлами записи
+func (r *Recorder) Dir() string {
+	return r.dir
+}
+
+func (r *Recorder) offsetLocked() int64 {
+	return time.Since(r.manifest.StartedAt).Milliseconds()
+}
+
+// Join отмечает появление участника в комнате
+func (r *Recorder) Join(participantID, username, displayName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.present[participantID]; ok || r.stopped {
+		return
+	}
+
+	r.present[participantID] = len(r.manifest.Participants)
+	r.manifest.Participants = append(r.manifest.Participants, Participant{
+		ID:          participantID,
+		Username:    username,
+		DisplayName: displayName,
+		JoinOffset:  r.offsetLocked(),
+	})
+}
+
+// Leave отмечает уход участника из комнаты
+func (r *Recorder) Leave(participantID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i, ok := r.present[participantID]; ok && !r.stopped {
+		r.manifest.Participants[i].LeaveOffset = r.offsetLocked()
+		delete(r.present, participantID)
+	}
+}
+
+// AddTrack создает файл для дорожки участника: Opus пишется в Ogg,
+// VP8 и VP9 - в IVF
+func (r *Recorder) AddTrack(participantID, trackID string, codec webrtc.RTPCodecCapability) (*Track, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return nil, ErrStopped
+	}
+
+	var kind, ext string
+	switch {
+	case strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus):
+		kind, ext = webrtc.RTPCodecTypeAudio.String(), ".ogg"
+	case strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8), strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP9):
+		kind, ext = webrtc.RTPCodecTypeVideo.String(), ".ivf"
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCodec, codec.MimeType)
+	}
+
+	// Идентификатор дорожки задает клиент, поэтому в имени файла его нет
+	name := fmt.Sprintf("%s-%d%s", participantID, len(r.manifest.Tracks), ext)
+	path := filepath.Join(r.dir, name)
+
+	var writer media.Writer
+	var err error
+	if kind == webrtc.RTPCodecTypeAudio.String() {
+		channels := codec.Channels
+		if channels == 0 {
+			channels = 2
+		}
+		writer, err = oggwriter.New(path, codec.ClockRate, channels)
+	} else {
+		writer, err = ivfwriter.New(path, ivfwriter.WithCodec(ivfCodec(codec.MimeType)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+
+	track := &Track{
+		recorder: r,
+		index:    len(r.manifest.Tracks),
+		path:     path,
+		writer:   writer,
+		vp8:      strings.EqualFold(codec.MimeType, webrtc.MimeTypeVP8),
+	}
+	r.manifest.Tracks = append(r.manifest.Tracks, TrackInfo{
+		ParticipantID: participantID,
+		TrackID:       trackID,
+		Kind:          kind,
+		Codec:         codec.MimeType,
+		File:          name,
+		StartOffset:   -1,
+	})
+	r.tracks = append(r.tracks, track)
+
+	return track, nil
+}
+
+// ivfCodec приводит MIME-тип к написанию, которое ожидает ivfwriter
+func ivfCodec(mimeType string) string {
+	if strings.EqualFold(mimeType, webrtc.MimeTypeVP9) {
+		return webrtc.MimeTypeVP9
+	}
+	return webrtc.MimeTypeVP8
+}
+
+// Stop закрывает все дорожки и сохраняет manifest.json. Дорожки, в которые
+// не пришло ни одного пакета, удаляются из манифеста и с диска
+func (r *Recorder) Stop() (*Manifest, error) {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		return nil, ErrStopped
+	}
+	r.stopped = true
+	tracks := r.tracks
+	r.mu.Unlock()
+
+	var errs []error
+	for _, track := range tracks {
+		if err := track.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	r.mu.Lock()
+	end := r.offsetLocked()
+	r.manifest.EndedAt = r.manifest.StartedAt.Add(time.Duration(end) * time.Millisecond)
+	for _, i := range r.present {
+		r.manifest.Participants[i].LeaveOffset = end
+	}
+	r.present = map[string]int{}
+
+	recorded := make([]TrackInfo, 0, len(r.manifest.Tracks))
+	for i, info := range r.manifest.Tracks {
+		if info.StartOffset < 0 {
+			if err := os.Remove(tracks[i].path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		recorded = append(recorded, info)
+	}
+	r.manifest.Tracks = recorded
+	manifest := r.manifest
+	r.mu.Unlock()
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, ManifestFile), data, 0o640); err != nil {
+		errs = append(errs, fmt.Errorf("recording: %w", err))
+	}
+
+	return &manifest, errors.Join(errs...)
+}
+
+func (r *Recorder) trackStarted(index int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.manifest.Tracks[index].StartOffset = r.offsetLocked()
+}
+
+func (r *Recorder) trackEnded(index int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.manifest.Tracks[index].StartOffset >= 0 {
+		r.manifest.Tracks[index].EndOffset = r.offsetLocked()
+	}
+}
+
+// Track - файл одной дорожки. Реализует webrtc.TrackLocalWriter, поэтому
+// пакеты в него пишутся так же, как подписчикам
+type Track struct {
+	recorder *Recorder
+	index    int
+	path     string
+	vp8      bool
+
+	mu      sync.Mutex
+	writer  media.Writer
+	started bool
+	closed  bool
+}
+
+// WriteRTP записывает пакет в файл. Первый пакет задает смещение начала дорожки
+func (t *Track) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if t.vp8 && emptyVP8Frame(payload) {
+		// ivfwriter не проверяет длину кадра после дескриптора VP8
+		return len(payload), nil
+	}
+
+	if err := t.writer.WriteRTP(&rtp.Packet{Header: *header, Payload: payload}); err != nil {
+		return 0, err
+	}
+	if !t.started {
+		t.started = true
+		t.recorder.trackStarted(t.index)
+	}
+
+	return len(payload), nil
+}
+
+// emptyVP8Frame сообщает, что после дескриптора VP8 не осталось данных кадра
+func emptyVP8Frame(payload []byte) bool {
+	packet := codecs.VP8Packet{}
+	if _, err := packet.Unmarshal(payload); err != nil {
+		return false
+	}
+
+	return len(packet.Payload) == 0
+}
+
+// Write записывает сериализованный RTP-пакет
+func (t *Track) Write(b []byte) (int, error) {
+	packet := &rtp.Packet{}
+	if err := packet.Unmarshal(b); err != nil {
+		return 0, err
+	}
+
+	if _, err := t.WriteRTP(&packet.Header, packet.Payload); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// Close закрывает файл дорожки; повторный вызов ничего не делает
+func (t *Track) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	t.recorder.trackEnded(t.index)
+
+	return t.writer.Close()
+}
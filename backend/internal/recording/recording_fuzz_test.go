@@ -0,0 +1,82 @@
+package recording
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// FuzzRecorderTrack проверяет запись произвольных RTP-пакетов в файлы дорожек
+// и согласованность манифеста после остановки
+func FuzzRecorderTrack(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add([]byte{0x10, 0x00, 0x9d, 0x01, 0x2a}, uint16(1), uint32(3000), true) // Ключевой кадр VP8
+	f.Add([]byte{0x10, 0x01, 0x00, 0x00}, uint16(65535), uint32(0), true)      // Промежуточный кадр VP8
+	f.Add([]byte{0xfc, 0xff, 0xfe}, uint16(100), uint32(960), false)           // Кадр Opus
+	f.Add([]byte{}, uint16(0), uint32(0), false)
+	f.Add([]byte{0x90, 0x80, 0x80, 0x10}, uint16(7), uint32(90000), true)
+
+	f.Fuzz(func(t *testing.T, payload []byte, seq uint16, timestamp uint32, video bool) {
+		cfg := Config{Enabled: true, SpoolDir: t.TempDir()}
+		recorder, err := Start(cfg, "room1", "host", "host")
+		if err != nil {
+			t.Fatalf("Не удалось начать запись: %v", err)
+		}
+		recorder.Join("p1", "user1", "User 1")
+
+		codec := webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}
+		if video {
+			codec = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}
+		}
+		track, err := recorder.AddTrack("p1", "track1", codec)
+		if err != nil {
+			t.Fatalf("Не удалось добавить дорожку: %v", err)
+		}
+
+		// Ошибки разбора полезной нагрузки допустимы, паники - нет
+		for i := range uint16(3) {
+			header := &rtp.Header{Version: 2, SequenceNumber: seq + i, Timestamp: timestamp, Marker: true}
+			_, _ = track.WriteRTP(header, payload)
+		}
+
+		manifest, err := recorder.Stop()
+		if err != nil {
+			t.Fatalf("Ошибка при остановке записи: %v", err)
+		}
+		if _, err := recorder.Stop(); err != ErrStopped {
+			t.Fatalf("Повторная остановка вернула %v, ожидалось %v", err, ErrStopped)
+		}
+		if _, err := track.WriteRTP(&rtp.Header{}, payload); err == nil {
+			t.Fatal("Запись в закрытую дорожку должна завершаться ошибкой")
+		}
+
+		data, err := os.ReadFile(filepath.Join(recorder.Dir(), ManifestFile))
+		if err != nil {
+			t.Fatalf("Манифест не сохранен: %v", err)
+		}
+		saved := Manifest{}
+		if err := json.Unmarshal(data, &saved); err != nil {
+			t.Fatalf("Манифест не разбирается: %v", err)
+		}
+		if len(saved.Participants) != 1 || saved.Participants[0].LeaveOffset < saved.Participants[0].JoinOffset {
+			t.Fatalf("Неверные участники в манифесте: %+v", saved.Participants)
+		}
+		if len(saved.Tracks) != len(manifest.Tracks) {
+			t.Fatalf("Сохранено %d дорожек, возвращено %d", len(saved.Tracks), len(manifest.Tracks))
+		}
+
+		// Каждая дорожка в манифесте должна существовать на диске
+		for _, info := range saved.Tracks {
+			if info.EndOffset < info.StartOffset {
+				t.Fatalf("Дорожка заканчивается раньше начала: %+v", info)
+			}
+			if _, err := os.Stat(filepath.Join(recorder.Dir(), info.File)); err != nil {
+				t.Fatalf("Файл дорожки %s не найден: %v", info.File, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,169 @@
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+
+	// DefaultURLTTL - время действия подписанной ссылки на файл записи
+	DefaultURLTTL = time.Hour
+)
+
+var (
+	ErrNotFound   = errors.New("recording: not found")
+	ErrInvalidKey = errors.New("recording: invalid key")
+)
+
+// Object - файл в хранилище записей
+type Object struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modified_at"`
+}
+
+// RecordingStore хранит файлы завершенных записей. Ключ файла имеет вид
+// "<комната>/<запись>/<файл>"
+type RecordingStore interface {
+	// Put сохраняет содержимое r под ключом key, заменяя прежнее
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get открывает файл; для отсутствующего ключа возвращает ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// List возвращает файлы, ключи которых начинаются с prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Delete удаляет файл; удаление отсутствующего ключа не считается ошибкой
+	Delete(ctx context.Context, key string) error
+	// SignedURL выдает ссылку, по которой файл можно скачать без авторизации до истечения ttl
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// NewStore создает хранилище, выбранное в конфигурации
+func NewStore(cfg Config) (RecordingStore, error) {
+	switch cfg.Storage {
+	case StorageLocal, "":
+		return NewLocalStore(cfg.Dir, []byte(cfg.URLSecret), LocalURLPrefix)
+	case StorageS3:
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("recording: unknown storage %q", cfg.Storage)
+	}
+}
+
+// Key собирает ключ файла записи
+func Key(roomID, recordingID, file string) string {
+	return path.Join(roomID, recordingID, file)
+}
+
+// validKey отклоняет ключи, которые могут выйти за пределы хранилища или не
+// переносятся между хранилищами: S3 требует UTF-8, а скрытые файлы локального
+// хранилища - это незавершенные загрузки
+func validKey(key string) bool {
+	if key == "" || !utf8.ValidString(key) || strings.ContainsRune(key, '\\') {
+		return false
+	}
+	if strings.IndexFunc(key, unicode.IsControl) >= 0 {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// validPrefix допускает пустой префикс и префиксы, оканчивающиеся на "/"
+func validPrefix(prefix string) bool {
+	return prefix == "" || validKey(strings.TrimSuffix(prefix, "/"))
+}
+
+// Archive переносит файлы остановленной записи из промежуточного каталога
+// в хранилище. Манифест сохраняется последним, поэтому в списке записей
+// появляются только полностью перенесенные
+func Archive(ctx context.Context, store RecordingStore, recorder *Recorder) error {
+	entries, err := os.ReadDir(recorder.Dir())
+	if err != nil {
+		return fmt.Errorf("recording: %w", err)
+	}
+
+	put := func(name string) error {
+		file, err := os.Open(filepath.Join(recorder.Dir(), name))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		return store.Put(ctx, Key(recorder.manifest.RoomID, recorder.ID(), name), file, info.Size())
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == ManifestFile {
+			continue
+		}
+		if err := put(entry.Name()); err != nil {
+			return fmt.Errorf("recording: archive %s: %w", entry.Name(), err)
+		}
+	}
+	if err := put(ManifestFile); err != nil {
+		return fmt.Errorf("recording: archive manifest: %w", err)
+	}
+
+	return os.RemoveAll(recorder.Dir())
+}
+
+// LoadManifest читает манифест записи из хранилища
+func LoadManifest(ctx context.Context, store RecordingStore, roomID, recordingID string) (*Manifest, error) {
+	reader, err := store.Get(ctx, Key(roomID, recordingID, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	manifest := &Manifest{}
+	if err := json.NewDecoder(reader).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("recording: manifest %s/%s: %w", roomID, recordingID, err)
+	}
+
+	return manifest, nil
+}
+
+// DeleteRecording удаляет все файлы записи. Манифест удаляется первым,
+// чтобы запись сразу пропала из списка
+func DeleteRecording(ctx context.Context, store RecordingStore, roomID, recordingID string) error {
+	objects, err := store.List(ctx, Key(roomID, recordingID, "")+"/")
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return ErrNotFound
+	}
+
+	if err := store.Delete(ctx, Key(roomID, recordingID, ManifestFile)); err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := store.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
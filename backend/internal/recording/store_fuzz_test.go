@@ -0,0 +1,281 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 - заменитель S3 для тестов: хранит объекты в памяти и проверяет
+// подписи SigV4 заголовков и presigned-ссылок
+type fakeS3 struct {
+	store  *S3Store
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) verify(r *http.Request) bool {
+	query := r.URL.Query()
+	if signature := query.Get("X-Amz-Signature"); signature != "" {
+		date, err := time.Parse(s3TimeFormat, query.Get("X-Amz-Date"))
+		if err != nil {
+			return false
+		}
+		query.Del("X-Amz-Signature")
+		u := *r.URL
+		u.Host = r.Host
+		u.RawQuery = query.Encode()
+		return signature == f.store.signature(date, r.Method, &u, r.Header, []string{"host"}, s3UnsignedBody)
+	}
+
+	date, err := time.Parse(s3TimeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	u := *r.URL
+	u.Host = r.Host
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	want := f.store.signature(date, r.Method, &u, r.Header, signed, r.Header.Get("X-Amz-Content-Sha256"))
+	return strings.HasSuffix(r.Header.Get("Authorization"), "Signature="+want)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.verify(r) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		prefix := r.URL.Query().Get("prefix")
+		keys := []string{}
+		for k := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		// Отдаем по одному объекту на страницу, чтобы проверить продолжение списка
+		start := 0
+		if token := r.URL.Query().Get("continuation-token"); token != "" {
+			start = sort.SearchStrings(keys, token)
+		}
+		result := struct {
+			XMLName               xml.Name `xml:"ListBucketResult"`
+			IsTruncated           bool
+			NextContinuationToken string
+			Contents              []struct{ Key string }
+		}{}
+		if start < len(keys) {
+			result.Contents = append(result.Contents, struct{ Key string }{keys[start]})
+		}
+		if start+1 < len(keys) {
+			result.IsTruncated, result.NextContinuationToken = true, keys[start+1]
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// checkStore проверяет сохранение, чтение, список и удаление файла
+func checkStore(t *testing.T, store RecordingStore, key string, data []byte) {
+	ctx := context.Background()
+
+	err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)))
+	if !validKey(key) {
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("Put(%q) = %v, ожидалось %v", key, err, ErrInvalidKey)
+		}
+		if _, err := store.SignedURL(ctx, key, time.Minute); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("SignedURL(%q) = %v, ожидалось %v", key, err, ErrInvalidKey)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Put(%q): %v", key, err)
+	}
+
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	got, _ := io.ReadAll(reader)
+	reader.Close()
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get(%q) вернул другие данные", key)
+	}
+
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != key {
+		t.Fatalf("List вернул %+v, ожидался ключ %q", objects, key)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete(%q): %v", key, err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(%q) после удаления = %v, ожидалось %v", key, err, ErrNotFound)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Повторное удаление %q: %v", key, err)
+	}
+}
+
+// FuzzLocalStore проверяет, что ключи не выходят за пределы каталога хранилища
+// и что подписанные ссылки принимаются только без изменений
+func FuzzLocalStore(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("room1/20250101T000000-abcd/p1-0.ogg", []byte("OggS"))
+	f.Add("room1/rec/manifest.json", []byte("{}"))
+	f.Add("../etc/passwd", []byte("x"))
+	f.Add("room1/../../x", []byte("x"))
+	f.Add("/abs", []byte("x"))
+	f.Add("a//b", []byte{})
+	f.Add("комната/запись с пробелом/файл?.ivf", []byte("DKIF"))
+
+	f.Fuzz(func(t *testing.T, key string, data []byte) {
+		store, err := NewLocalStore(t.TempDir(), []byte("secret"), LocalURLPrefix)
+		if err != nil {
+			t.Fatalf("Не удалось создать хранилище: %v", err)
+		}
+
+		checkStore(t, store, key, data)
+		if !validKey(key) {
+			return
+		}
+
+		link, err := store.SignedURL(context.Background(), key, time.Minute)
+		if err != nil {
+			t.Fatalf("SignedURL(%q): %v", key, err)
+		}
+		u, err := url.Parse(link)
+		if err != nil {
+			t.Fatalf("Некорректная ссылка %q: %v", link, err)
+		}
+		gotKey := strings.TrimPrefix(u.Path, LocalURLPrefix)
+		if gotKey != key {
+			t.Fatalf("Ссылка ведет на %q вместо %q", gotKey, key)
+		}
+
+		query := u.Query()
+		if err := store.Verify(gotKey, query.Get("expires"), query.Get("signature")); err != nil {
+			t.Fatalf("Подпись не принята: %v", err)
+		}
+		if err := store.Verify(gotKey+"x", query.Get("expires"), query.Get("signature")); err == nil {
+			t.Fatal("Подпись принята для другого ключа")
+		}
+
+		store.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		if err := store.Verify(gotKey, query.Get("expires"), query.Get("signature")); !errors.Is(err, ErrURLExpired) {
+			t.Fatalf("Истекшая ссылка: %v, ожидалось %v", err, ErrURLExpired)
+		}
+	})
+}
+
+// FuzzS3Store проверяет подписи запросов и presigned-ссылок на заменителе S3
+func FuzzS3Store(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("room1/20250101T000000-abcd/p1-0.ivf", []byte("DKIF"))
+	f.Add("room1/rec/manifest.json", []byte(`{"id":"rec"}`))
+	f.Add("комната/запись с пробелом/файл+(1)!.ogg", []byte("OggS"))
+	f.Add("a/b;c=d&e/f%20g", []byte{})
+	f.Add("../x", []byte("x"))
+
+	f.Fuzz(func(t *testing.T, key string, data []byte) {
+		fake := &fakeS3{bucket: "meet", objects: map[string][]byte{}}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		store, err := NewS3Store(S3Config{
+			Endpoint:  server.URL,
+			Region:    "us-east-1",
+			Bucket:    "meet",
+			AccessKey: "access",
+			SecretKey: "secret",
+			PathStyle: true,
+		})
+		if err != nil {
+			t.Fatalf("Не удалось создать хранилище: %v", err)
+		}
+		fake.store = store
+
+		checkStore(t, store, key, data)
+		if !validKey(key) {
+			return
+		}
+
+		// Список из нескольких страниц
+		ctx := context.Background()
+		for _, suffix := range []string{"a", "b", "c"} {
+			if err := store.Put(ctx, key+suffix, bytes.NewReader(data), int64(len(data))); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+		objects, err := store.List(ctx, "")
+		if err != nil || len(objects) != 3 {
+			t.Fatalf("List вернул %d объектов (%v), ожидалось 3", len(objects), err)
+		}
+
+		link, err := store.SignedURL(ctx, key+"a", time.Minute)
+		if err != nil {
+			t.Fatalf("SignedURL: %v", err)
+		}
+		resp, err := http.Get(link)
+		if err != nil {
+			t.Fatalf("GET %s: %v", link, err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !bytes.Equal(got, data) {
+			t.Fatalf("Presigned-ссылка %s: %s", link, resp.Status)
+		}
+
+		resp, err = http.Get(strings.Replace(link, "X-Amz-Expires=60", "X-Amz-Expires=600", 1))
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("Измененная ссылка принята: %s", resp.Status)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package signaling
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	initialBitrate = 1_000_000
+	minBitrate     = 100_000
+	maxBitrate     = 10_000_000
+	// audioReserve is kept out of the video share for every audio track a
+	// subscriber receives.
+	audioReserve = 40_000
+	// rembTimeout is how long a REMB report overrides the send-side estimate.
+	rembTimeout = 5 * time.Second
+)
+
+// subscriberBandwidth estimates how much media can be sent to one
+// participant. The send-side estimator (GCC over transport-wide congestion
+// control feedback) is used unless the participant reports REMB instead.
+type subscriberBandwidth struct {
+	pc        *webrtc.PeerConnection
+	estimator cc.BandwidthEstimator
+
+	mu sync.Mutex
+	// gccActive is set once the estimator has reacted to feedback; before
+	// that its bitrate is only the initial guess.
+	gccActive bool
+	remb      uint64
+	rembAt    time.Time
+}
+
+// newPeerConnection creates a PeerConnection with its own interceptor
+// registry, since the congestion controller estimates one connection.
+func newPeerConnection(config webrtc.Configuration) (*webrtc.PeerConnection, *subscriberBandwidth, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		return nil, nil, err
+	}
+
+	// Publishers report the level of every audio packet for speaker detection
+	if err := mediaEngine.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: audioLevelURI}, webrtc.RTPCodecTypeAudio); err != nil {
+		return nil, nil, err
+	}
+
+	registry := &interceptor.Registry{}
+
+	congestionController, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+		// Layer selection adapts the rate, so packets aren't held back by a pacer
+		return gcc.NewSendSideBWE(
+			gcc.SendSideBWEInitialBitrate(initialBitrate),
+			gcc.SendSideBWEMinBitrate(minBitrate),
+			gcc.SendSideBWEMaxBitrate(maxBitrate),
+			gcc.SendSideBWEPacer(gcc.NewNoOpPacer()),
+		)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	estimators := make(chan cc.BandwidthEstimator, 1)
+	congestionController.OnNewPeerConnection(func(_ string, estimator cc.BandwidthEstimator) {
+		estimators <- estimator
+	})
+	registry.Add(congestionController)
+
+	if err = webrtc.ConfigureTWCCHeaderExtensionSender(mediaEngine, registry); err != nil {
+		return nil, nil, err
+	}
+
+	if err = configureInterceptors(mediaEngine, registry); err != nil {
+		return nil, nil, err
+	}
+
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine), webrtc.WithInterceptorRegistry(registry))
+
+	pc, err := api.NewPeerConnection(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bandwidth := &subscriberBandwidth{pc: pc, estimator: <-estimators}
+	bandwidth.estimator.OnTargetBitrateChange(func(int) {
+		bandwidth.mu.Lock()
+		bandwidth.gccActive = true
+		bandwidth.mu.Unlock()
+
+		bandwidth.allocate()
+	})
+
+	return pc, bandwidth, nil
+}
+
+// estimate returns the current estimate in bits per second and where it
+// comes from; 0 means nothing is known yet.
+func (b *subscriberBandwidth) estimate() (uint64, string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.remb > 0 && time.Since(b.rembAt) < rembTimeout:
+		return b.remb, "remb"
+	case b.gccActive:
+		return uint64(b.estimator.GetTargetBitrate()), "twcc"
+	default:
+		return 0, ""
+	}
+}
+
+func (b *subscriberBandwidth) setREMB(bitrate uint64) {
+	b.mu.Lock()
+	b.remb, b.rembAt = bitrate, time.Now()
+	b.mu.Unlock()
+
+	b.allocate()
+}
+
+// allocate splits the estimate evenly between the video tracks the
+// participant receives and that aren't paused; each track then picks a layer
+// that fits its share or is suspended.
+func (b *subscriberBandwidth) allocate() {
+	estimate, _ := b.estimate()
+	if estimate == 0 {
+		return
+	}
+
+	type videoSender struct {
+		track *forwardTrack
+		ssrc  webrtc.SSRC
+	}
+
+	var video []videoSender
+	var audio uint64
+	for _, sender := range b.pc.GetSenders() {
+		track, ok := sender.Track().(*forwardTrack)
+		if !ok {
+			continue
+		}
+
+		if track.Kind() == webrtc.RTPCodecTypeAudio {
+			audio++
+
+			continue
+		}
+
+		// Paused tracks aren't sent, so they don't get a share
+		if encodings := sender.GetParameters().Encodings; len(encodings) > 0 && !track.isPaused(encodings[0].SSRC) {
+			video = append(video, videoSender{track: track, ssrc: encodings[0].SSRC})
+		}
+	}
+	if len(video) == 0 {
+		return
+	}
+
+	available := uint64(1)
+	if reserve := audio * audioReserve; estimate > reserve {
+		available = estimate - reserve
+	}
+
+	share := max(available/uint64(len(video)), 1)
+	for _, sender := range video {
+		sender.track.setEstimate(sender.ssrc, share)
+	}
+}
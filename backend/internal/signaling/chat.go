@@ -0,0 +1,59 @@
+package signaling
+
+import (
+	"errors"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/logging"
+)
+
+type chatPayload struct {
+	Text string `json:"text"`
+}
+
+type chatHistoryPayload struct {
+	Messages []auth.ChatMessage `json:"messages"`
+}
+
+func (sc *signalingClient) handleChat(message *websocketMessage) error {
+	payload := chatPayload{}
+	if err := message.decode(&payload); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	chatMessage, err := sc.chatStore.AddMessage(sc.ctx, sc.room.ID(), auth.ChatMessage{
+		ParticipantID: sc.participantID,
+		Username:      sc.username,
+		DisplayName:   sc.displayName,
+		Text:          payload.Text,
+	})
+	if errors.Is(err, auth.ErrInvalidChatMessage) {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	} else if err != nil {
+		return internalError(err)
+	}
+
+	// The sender gets the stored message as a reply to correlate it with
+	// the one it sent, everyone else as a plain event
+	var out outbox
+	sc.room.listLock.RLock()
+	sc.room.broadcastLocked(&out, "chat", chatMessage, sc.participantID)
+	sc.room.listLock.RUnlock()
+	out.send()
+
+	return sc.websocket.reply(message.ID, "chat", chatMessage)
+}
+
+// sendChatHistory delivers the messages posted before the client joined.
+func (sc *signalingClient) sendChatHistory() {
+	messages, err := sc.chatStore.GetMessages(sc.ctx, sc.room.ID(), 0)
+	if err != nil {
+		logging.Errorf("Failed to load chat history of room %s: %v", sc.room.ID(), err)
+
+		return
+	}
+
+	if err := sc.websocket.send("chat_history", &chatHistoryPayload{Messages: messages}); err != nil {
+		logging.Warnf("Failed to send chat history: %v", err)
+	}
+}
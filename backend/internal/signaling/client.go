@@ -0,0 +1,189 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/logging"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// signalingClient is the state of one WebSocket connection shared by the
+// handlers of client events.
+type signalingClient struct {
+	ctx  context.Context
+	room *Room
+	identity
+	participantID  string
+	peerConnection *webrtc.PeerConnection
+	websocket      *threadSafeWriter
+
+	roomStore *auth.RoomStore
+	chatStore *auth.ChatStore
+	logStore  *auth.LogStore
+
+	// handshakeDone is only accessed from the read loop.
+	handshakeDone bool
+}
+
+// process decodes one raw client message and passes it to handle. It returns
+// false when the connection must be closed.
+func (sc *signalingClient) process(raw []byte, handle func(*websocketMessage) error) bool {
+	logging.Debugf("Got message: %s", raw)
+
+	message := &websocketMessage{}
+	if err := json.Unmarshal(raw, message); err != nil {
+		logging.Warnf("Failed to unmarshal json to message: %v", err)
+
+		return sc.websocket.sendError("", newProtocolError(errCodeBadRequest, "malformed message")) == nil
+	}
+
+	if err := handle(message); err != nil {
+		var protoErr *protocolError
+		if !errors.As(err, &protoErr) {
+			logging.Errorf("Failed to handle %s: %v", message.Event, err)
+
+			return false
+		}
+
+		logging.Warnf("Rejected %s from %s: %v", message.Event, sc.username, err)
+
+		return sc.websocket.sendError(message.ID, protoErr) == nil
+	}
+
+	return true
+}
+
+// handle processes one client message. A *protocolError is reported back to
+// the client and the connection stays open; any other error closes it.
+func (sc *signalingClient) handle(message *websocketMessage) error {
+	switch message.Event {
+	case "hello":
+		return sc.handleHello(message)
+	case "candidate":
+		return sc.handleCandidate(message)
+	case "offer":
+		return sc.handleOffer(message)
+	case "answer":
+		return sc.handleAnswer(message)
+	case "chat":
+		return sc.handleChat(message)
+	case "mute":
+		return sc.handleMute(message)
+	case "force_mute":
+		return sc.handleForceMute(message)
+	case "request_unmute":
+		return sc.handleRequestUnmute(message)
+	case "set_role":
+		return sc.handleSetRole(message)
+	case "kick":
+		return sc.handleKick(message)
+	case "ban":
+		return sc.handleBan(message)
+	case "lock_room":
+		return sc.handleLockRoom(message)
+	case "set_lobby":
+		return sc.handleSetLobby(message)
+	case "admit":
+		return sc.handleAdmit(message)
+	case "deny":
+		return sc.handleDeny(message)
+	case "set_layer":
+		return sc.handleSetLayer(message)
+	case "set_last_n":
+		return sc.handleSetLastN(message)
+	case "pin":
+		return sc.handlePin(message)
+	case "start_recording":
+		return sc.handleStartRecording(message)
+	case "stop_recording":
+		return sc.handleStopRecording(message)
+	default:
+		return newProtocolError(errCodeUnknownEvent, "unknown event "+message.Event)
+	}
+}
+
+func (sc *signalingClient) handleHello(message *websocketMessage) error {
+	if sc.handshakeDone {
+		return newProtocolError(errCodeBadRequest, "handshake already completed")
+	}
+
+	hello := helloPayload{}
+	if err := message.decode(&hello); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	version, err := negotiateVersion(hello.Version)
+	if err != nil {
+		return err
+	}
+
+	sc.handshakeDone = true
+	sc.websocket.setVersion(version)
+
+	return sc.websocket.reply(message.ID, "welcome", &welcomePayload{
+		Version:       version,
+		Username:      sc.username,
+		DisplayName:   sc.displayName,
+		ParticipantID: sc.participantID,
+		Room:          sc.room.ID(),
+		DataChannel:   dataChannelLabel,
+	})
+}
+
+func (sc *signalingClient) handleCandidate(message *websocketMessage) error {
+	candidate := webrtc.ICECandidateInit{}
+	if err := message.decode(&candidate); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	logging.Debugf("Got candidate: %v", candidate)
+
+	if err := sc.peerConnection.AddICECandidate(candidate); err != nil {
+		return newProtocolError(errCodeNegotiation, err.Error())
+	}
+
+	return nil
+}
+
+func (sc *signalingClient) handleAnswer(message *websocketMessage) error {
+	answer := webrtc.SessionDescription{}
+	if err := message.decode(&answer); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	logging.Debugf("Got answer: %v", answer)
+
+	if err := sc.peerConnection.SetRemoteDescription(answer); err != nil {
+		return newProtocolError(errCodeNegotiation, err.Error())
+	}
+
+	return nil
+}
+
+func (sc *signalingClient) handleOffer(message *websocketMessage) error {
+	offer := webrtc.SessionDescription{}
+	if err := message.decode(&offer); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+	if offer.Type != webrtc.SDPTypeOffer {
+		return newProtocolError(errCodeInvalidPayload, "expected an offer")
+	}
+
+	logging.Debugf("Got offer: %v", offer)
+
+	renegotiate, err := sc.room.answerOffer(sc.peerConnection, sc.websocket, message.ID, offer)
+	if err != nil {
+		return newProtocolError(errCodeNegotiation, err.Error())
+	}
+
+	if renegotiate {
+		// The rolled back offer still carried tracks the client must receive
+		sc.room.signalPeerConnections()
+	}
+
+	return nil
+}
@@ -2,29 +2,109 @@ package signaling
 
 import (
 	"encoding/json"
-	"log"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/logging"
+	"github.com/Coderovshik/meet/internal/recording"
+
 	"github.com/gorilla/websocket"
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v4"
 )
 
-var (
-	listLock        sync.RWMutex
-	peerConnections []peerConnectionState
-	trackLocals     map[string]*webrtc.TrackLocalStaticRTP = make(map[string]*webrtc.TrackLocalStaticRTP)
-)
-
 type peerConnectionState struct {
 	peerConnection *webrtc.PeerConnection
 	websocket      *threadSafeWriter
+	username       string
+	// id identifies the connection in presence events, since one user may
+	// join the same room from several devices.
+	id    string
+	media *mediaState
+	// role is one of the auth.Role* values.
+	role string
+	// displayName is shown to others; for registered users it is the username.
+	displayName string
+	// invite is set for guests, see guest.go.
+	invite *auth.Invite
+	// dataChannel relays messages between participants, see datachannel.go.
+	dataChannel *webrtc.DataChannel
+	// bandwidth estimates the participant's downlink, see bandwidth.go.
+	bandwidth *subscriberBandwidth
+	// pins are the publishers whose video the participant always receives
+	// and forwarded the ones it was last told about, see lastn.go.
+	pins      map[string]bool
+	forwarded []string
 }
 
 type threadSafeWriter struct {
 	*websocket.Conn
 	sync.Mutex
+
+	// version is the negotiated protocol version and lastID the ID of the
+	// last message sent; both are guarded by the mutex.
+	version int
+	lastID  uint64
+
+	// queued and delivered order the messages rooms send after releasing
+	// listLock, see outbox; both are guarded by order.
+	order     sync.Mutex
+	turn      *sync.Cond
+	queued    uint64
+	delivered uint64
+}
+
+func newThreadSafeWriter(conn *websocket.Conn) *threadSafeWriter {
+	t := &threadSafeWriter{Conn: conn}
+	t.turn = sync.NewCond(&t.order)
+
+	return t
+}
+
+// ticket reserves the next place in the delivery order. Tickets are taken
+// under listLock, so the client gets the messages of successive critical
+// sections in the order the sections ran.
+func (t *threadSafeWriter) ticket() uint64 {
+	t.order.Lock()
+	defer t.order.Unlock()
+
+	t.queued++
+
+	return t.queued
+}
+
+// replyInTurn writes an event once the messages with earlier tickets were sent.
+func (t *threadSafeWriter) replyInTurn(ticket uint64, replyTo, event string, payload any) error {
+	t.waitTurn(ticket)
+	defer t.endTurn(ticket)
+
+	return t.reply(replyTo, event, payload)
+}
+
+// skipTurn gives up a ticket that turned out to have nothing to send.
+func (t *threadSafeWriter) skipTurn(ticket uint64) {
+	t.waitTurn(ticket)
+	t.endTurn(ticket)
+}
+
+func (t *threadSafeWriter) waitTurn(ticket uint64) {
+	t.order.Lock()
+	defer t.order.Unlock()
+
+	for t.delivered+1 != ticket {
+		t.turn.Wait()
+	}
+}
+
+func (t *threadSafeWriter) endTurn(ticket uint64) {
+	t.order.Lock()
+	defer t.order.Unlock()
+
+	t.delivered = ticket
+	t.turn.Broadcast()
 }
 
 func (t *threadSafeWriter) WriteJSON(v interface{}) error {
@@ -34,65 +114,284 @@ func (t *threadSafeWriter) WriteJSON(v interface{}) error {
 	return t.Conn.WriteJSON(v)
 }
 
-func addTrack(t *webrtc.TrackRemote) *webrtc.TrackLocalStaticRTP { // nolint
-	listLock.Lock()
+// setVersion switches the connection to the negotiated protocol version.
+func (t *threadSafeWriter) setVersion(version int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.version = version
+}
+
+// send writes a server-initiated event with the given payload, which may be nil.
+func (t *threadSafeWriter) send(event string, payload any) error {
+	return t.reply("", event, payload)
+}
+
+// reply writes an event answering the client message with ID replyTo.
+func (t *threadSafeWriter) reply(replyTo, event string, payload any) error {
+	message := &websocketMessage{Event: event, ReplyTo: replyTo}
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		message.Payload = raw
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.lastID++
+	message.ID = "s" + strconv.FormatUint(t.lastID, 10)
+	if t.version == 0 && message.Payload != nil {
+		message.Data = string(message.Payload)
+	}
+
+	return t.Conn.WriteJSON(message)
+}
+
+// sendError reports a failed client message as an "error" event.
+func (t *threadSafeWriter) sendError(replyTo string, err *protocolError) error {
+	return t.reply(replyTo, "error", &errorPayload{Code: err.code, Message: err.message})
+}
+
+// addPeer adds a participant to the room, sends it the participant list and
+// announces it to everyone else. Moderators also get the pending knocks.
+func (room *Room) addPeer(peer peerConnectionState) {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	room.peerConnections = append(room.peerConnections, peer)
+	id, ws := peer.id, peer.websocket
+	room.speakerOrder = append(room.speakerOrder, id)
+
+	participants := make([]participantInfo, 0, len(room.peerConnections))
+	for i := range room.peerConnections {
+		participants = append(participants, room.participantInfoLocked(&room.peerConnections[i]))
+	}
+	out.add(ws, "participant_list", &participantListPayload{
+		Self:         id,
+		Participants: participants,
+	})
+
+	room.broadcastLocked(&out, "participant_joined", &participants[len(participants)-1], id)
+
+	if speaker := room.speakers.current(); speaker != "" {
+		out.add(ws, "active_speaker", &activeSpeakerPayload{ID: speaker})
+	}
+
+	if room.recorder != nil {
+		room.recorder.Join(id, peer.username, peer.displayName)
+		out.add(ws, "recording_started", &recordingPayload{ID: room.recorder.ID()})
+	}
+
+	room.applyLastNLocked(&out)
+
+	if auth.CanModerate(peer.role) {
+		for _, entry := range room.lobby {
+			out.add(ws, "knock", entry.knock())
+		}
+	}
+}
+
+// removePeer drops the participant with the given ID and announces that it left.
+func (room *Room) removePeer(id string) {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	for i := range room.peerConnections {
+		if room.peerConnections[i].id == id {
+			room.removePeerLocked(&out, i)
+
+			return
+		}
+	}
+}
+
+func (room *Room) removePeerLocked(out *outbox, i int) {
+	left := room.participantInfoLocked(&room.peerConnections[i])
+	room.peerConnections = append(room.peerConnections[:i], room.peerConnections[i+1:]...)
+	room.broadcastLocked(out, "participant_left", &left, "")
+	if speaker, changed := room.speakers.remove(left.ID); changed {
+		room.broadcastLocked(out, "active_speaker", &activeSpeakerPayload{ID: speaker}, "")
+		room.promoteSpeakerLocked(speaker)
+	}
+
+	room.speakerOrder = slices.DeleteFunc(room.speakerOrder, func(id string) bool { return id == left.ID })
+	for i := range room.peerConnections {
+		delete(room.peerConnections[i].pins, left.ID)
+	}
+	room.applyLastNLocked(out)
+	if auth.CanModerate(left.Role) {
+		room.denyLobbyWithoutModeratorLocked(out)
+	}
+
+	if room.recorder != nil {
+		room.recorder.Leave(left.ID)
+	}
+}
+
+// addTrack starts forwarding a remote track published over pc. Further
+// simulcast layers of a track become layers of the same forwardTrack, which
+// doesn't require renegotiation.
+func (room *Room) addTrack(t *webrtc.TrackRemote, ownerID string, pc *webrtc.PeerConnection) *forwardTrack {
+	var out outbox
+	room.listLock.Lock()
+
+	if trackLocal, ok := room.trackLocals[t.ID()]; ok && t.RID() != "" && room.trackOwners[t.ID()] == ownerID {
+		trackLocal.addLayer(t)
+		room.announceUpdateLocked(&out, ownerID)
+		room.listLock.Unlock()
+		out.send()
+
+		return trackLocal
+	}
+
+	var (
+		trackLocal *forwardTrack
+		recorder   *recording.Recorder
+	)
 	defer func() {
-		listLock.Unlock()
-		signalPeerConnections()
+		room.listLock.Unlock()
+		out.send()
+		if recorder != nil {
+			room.recordTracks(recorder, []recordedTrack{{track: trackLocal, owner: ownerID}})
+		}
+		room.signalPeerConnections()
 	}()
 
-	trackLocal, err := webrtc.NewTrackLocalStaticRTP(t.Codec().RTPCodecCapability, t.ID(), t.StreamID())
-	if err != nil {
-		panic(err)
-	}
+	trackLocal = newForwardTrack(t, func(ssrc webrtc.SSRC) {
+		if err := pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(ssrc)}}); err != nil {
+			logging.Debugf("Failed to request key frame: %v", err)
+		}
+	})
 
-	trackLocals[t.ID()] = trackLocal
+	room.trackLocals[t.ID()] = trackLocal
+	room.trackOwners[t.ID()] = ownerID
+	room.announceUpdateLocked(&out, ownerID)
+	recorder = room.recorder
 
 	return trackLocal
 }
 
-func removeTrack(t *webrtc.TrackLocalStaticRTP) {
-	listLock.Lock()
+// removeTrack drops the layer of a remote track that ended and stops
+// forwarding the track once no layers are left.
+func (room *Room) removeTrack(t *forwardTrack, rid string) {
+	var out outbox
+	room.listLock.Lock()
+
+	ownerID := room.trackOwners[t.ID()]
+	if t.removeLayer(rid) > 0 {
+		room.announceUpdateLocked(&out, ownerID)
+		room.listLock.Unlock()
+		out.send()
+
+		return
+	}
+
 	defer func() {
-		listLock.Unlock()
-		signalPeerConnections()
+		room.listLock.Unlock()
+		out.send()
+		stopRecordingTrack(t)
+		room.signalPeerConnections()
 	}()
 
-	delete(trackLocals, t.ID())
+	if room.trackLocals[t.ID()] != t {
+		return
+	}
+
+	delete(room.trackLocals, t.ID())
+	delete(room.trackOwners, t.ID())
+	room.announceUpdateLocked(&out, ownerID)
 }
 
-func signalPeerConnections() { // nolint
-	listLock.Lock()
+// answerOffer applies an offer from the client, which is how publishers send
+// simulcast: only the offering side can declare RID layers. A pending server
+// offer is rolled back, in which case the caller must renegotiate.
+func (room *Room) answerOffer(pc *webrtc.PeerConnection, ws *threadSafeWriter, replyTo string, offer webrtc.SessionDescription) (bool, error) {
+	room.listLock.Lock()
+	rolledBack, answer, err := answerOfferLocked(pc, offer)
+	// Taken under listLock so the answer can't overtake an earlier offer
+	ticket := ws.ticket()
+	room.listLock.Unlock()
+
+	if err != nil {
+		// The ticket must be used even though there's nothing to send
+		ws.skipTurn(ticket)
+
+		return rolledBack, err
+	}
+
+	logging.Debugf("Send answer to client: %v", answer)
+
+	return rolledBack, ws.replyInTurn(ticket, replyTo, "answer", answer)
+}
+
+func answerOfferLocked(pc *webrtc.PeerConnection, offer webrtc.SessionDescription) (bool, *webrtc.SessionDescription, error) {
+	rolledBack := false
+	if pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer {
+		if err := pc.SetLocalDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeRollback}); err != nil {
+			return false, nil, err
+		}
+		rolledBack = true
+	}
+
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		return rolledBack, nil, err
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return rolledBack, nil, err
+	}
+
+	if err = pc.SetLocalDescription(answer); err != nil {
+		return rolledBack, nil, err
+	}
+
+	return rolledBack, &answer, nil
+}
+
+func (room *Room) signalPeerConnections() { // nolint
+	var out outbox
+	room.listLock.Lock()
 	defer func() {
-		listLock.Unlock()
-		dispatchKeyFrame()
+		// New senders start paused if their publisher is outside the last N
+		room.applyLastNLocked(&out)
+		room.listLock.Unlock()
+		out.send()
+		room.dispatchKeyFrame()
 	}()
 
 	attemptSync := func() (tryAgain bool) {
-		for i := range peerConnections {
-			if peerConnections[i].peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed {
-				peerConnections = append(peerConnections[:i], peerConnections[i+1:]...)
+		for i := range room.peerConnections {
+			if room.peerConnections[i].peerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed {
+				room.removePeerLocked(&out, i)
 
 				return true
 			}
 
 			existingSenders := map[string]bool{}
 
-			for _, sender := range peerConnections[i].peerConnection.GetSenders() {
+			for _, sender := range room.peerConnections[i].peerConnection.GetSenders() {
 				if sender.Track() == nil {
 					continue
 				}
 
 				existingSenders[sender.Track().ID()] = true
 
-				if _, ok := trackLocals[sender.Track().ID()]; !ok {
-					if err := peerConnections[i].peerConnection.RemoveTrack(sender); err != nil {
+				if _, ok := room.trackLocals[sender.Track().ID()]; !ok {
+					if err := room.peerConnections[i].peerConnection.RemoveTrack(sender); err != nil {
 						return true
 					}
 				}
 			}
 
-			for _, receiver := range peerConnections[i].peerConnection.GetReceivers() {
+			for _, receiver := range room.peerConnections[i].peerConnection.GetReceivers() {
 				if receiver.Track() == nil {
 					continue
 				}
@@ -100,38 +399,29 @@ func signalPeerConnections() { // nolint
 				existingSenders[receiver.Track().ID()] = true
 			}
 
-			for trackID := range trackLocals {
+			for trackID := range room.trackLocals {
 				if _, ok := existingSenders[trackID]; !ok {
-					if _, err := peerConnections[i].peerConnection.AddTrack(trackLocals[trackID]); err != nil {
+					sender, err := room.peerConnections[i].peerConnection.AddTrack(room.trackLocals[trackID])
+					if err != nil {
 						return true
 					}
+
+					go readSenderRTCP(room.peerConnections[i].bandwidth, sender, room.trackLocals[trackID])
 				}
 			}
 
-			offer, err := peerConnections[i].peerConnection.CreateOffer(nil)
+			offer, err := room.peerConnections[i].peerConnection.CreateOffer(nil)
 			if err != nil {
 				return true
 			}
 
-			if err = peerConnections[i].peerConnection.SetLocalDescription(offer); err != nil {
-				return true
-			}
-
-			offerString, err := json.Marshal(offer)
-			if err != nil {
-				log.Printf("Failed to marshal offer to json: %v", err)
-
+			if err = room.peerConnections[i].peerConnection.SetLocalDescription(offer); err != nil {
 				return true
 			}
 
-			log.Printf("Send offer to client: %v", offer)
+			logging.Debugf("Send offer to client: %v", offer)
 
-			if err = peerConnections[i].websocket.WriteJSON(&websocketMessage{
-				Event: "offer",
-				Data:  string(offerString),
-			}); err != nil {
-				return true
-			}
+			out.add(room.peerConnections[i].websocket, "offer", offer)
 		}
 
 		return tryAgain
@@ -141,7 +431,7 @@ func signalPeerConnections() { // nolint
 		if syncAttempt == 25 {
 			go func() {
 				time.Sleep(time.Second * 3)
-				signalPeerConnections()
+				room.signalPeerConnections()
 			}()
 
 			return
@@ -153,21 +443,11 @@ func signalPeerConnections() { // nolint
 	}
 }
 
-func dispatchKeyFrame() {
-	listLock.Lock()
-	defer listLock.Unlock()
+func (room *Room) dispatchKeyFrame() {
+	room.listLock.Lock()
+	defer room.listLock.Unlock()
 
-	for i := range peerConnections {
-		for _, receiver := range peerConnections[i].peerConnection.GetReceivers() {
-			if receiver.Track() == nil {
-				continue
-			}
-
-			_ = peerConnections[i].peerConnection.WriteRTCP([]rtcp.Packet{
-				&rtcp.PictureLossIndication{
-					MediaSSRC: uint32(receiver.Track().SSRC()),
-				},
-			})
-		}
+	for _, trackLocal := range room.trackLocals {
+		trackLocal.requestKeyFrames()
 	}
 }
@@ -0,0 +1,102 @@
+package signaling
+
+import (
+	"encoding/json"
+
+	"github.com/Coderovshik/meet/internal/logging"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// dataChannelLabel is the label of the relay channel the server opens on
+	// every PeerConnection. Clients receive it through ondatachannel.
+	dataChannelLabel = "meet"
+	// maxDataMessageSize keeps relayed messages within what every SCTP
+	// implementation delivers without fragmentation issues.
+	maxDataMessageSize = 16 * 1024
+)
+
+// dataEnvelope is the format of relayed messages. Clients send {to, data},
+// where an empty to means everyone else in the room; recipients get
+// {from, data}. Failures are reported back to the sender as {error}.
+type dataEnvelope struct {
+	From  string          `json:"from,omitempty"`
+	To    string          `json:"to,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+// openDataChannel creates the relay channel of a participant. It must be
+// called before the first offer so the channel is part of it.
+func (room *Room) openDataChannel(pc *webrtc.PeerConnection, participantID string) (*webrtc.DataChannel, error) {
+	dc, err := pc.CreateDataChannel(dataChannelLabel, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if errMessage := room.relayData(participantID, msg); errMessage != "" {
+			sendData(dc, &dataEnvelope{Error: errMessage})
+		}
+	})
+
+	return dc, nil
+}
+
+// relayData forwards a message to its recipients and returns an error
+// description for the sender if it can't be delivered.
+func (room *Room) relayData(fromID string, msg webrtc.DataChannelMessage) string {
+	if !msg.IsString {
+		return "only text messages are relayed"
+	}
+	if len(msg.Data) > maxDataMessageSize {
+		return "message too large"
+	}
+
+	envelope := dataEnvelope{}
+	if err := json.Unmarshal(msg.Data, &envelope); err != nil || len(envelope.Data) == 0 {
+		return "expected {\"to\", \"data\"}"
+	}
+
+	relayed := &dataEnvelope{From: fromID, Data: envelope.Data}
+
+	room.listLock.RLock()
+	defer room.listLock.RUnlock()
+
+	if envelope.To != "" {
+		peer := room.findPeerLocked(envelope.To)
+		if peer == nil {
+			return "unknown participant"
+		}
+
+		sendData(peer.dataChannel, relayed)
+
+		return ""
+	}
+
+	for i := range room.peerConnections {
+		if room.peerConnections[i].id != fromID {
+			sendData(room.peerConnections[i].dataChannel, relayed)
+		}
+	}
+
+	return ""
+}
+
+func sendData(dc *webrtc.DataChannel, envelope *dataEnvelope) {
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+
+	raw, err := json.Marshal(envelope)
+	if err != nil {
+		logging.Errorf("Failed to marshal data channel message: %v", err)
+
+		return
+	}
+
+	if err := dc.SendText(string(raw)); err != nil {
+		logging.Debugf("Failed to relay data channel message: %v", err)
+	}
+}
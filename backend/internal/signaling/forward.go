@@ -0,0 +1,457 @@
+package signaling
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Coderovshik/meet/internal/logging"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// layerTimeout is how long a simulcast layer may stay silent before it's
+	// treated as disabled by the publisher.
+	layerTimeout = 2 * time.Second
+	// bitrateWindow is the interval over which layer bitrates are measured.
+	bitrateWindow = time.Second
+	// minKeyFrameInterval limits key frame requests sent to a publisher per
+	// layer: subscribers joining or losing packets at once need one key frame.
+	minKeyFrameInterval = 500 * time.Millisecond
+)
+
+var errLayerNotFound = errors.New("layer not found")
+
+// forwardTrack fans the packets of one published track out to every
+// subscriber. A simulcast track has one layer per RID and each subscriber
+// receives one of them, so SSRC, sequence and timestamp rewriting is kept
+// per binding, keyed by the SSRC of the subscriber's RTPSender.
+type forwardTrack struct {
+	id       string
+	streamID string
+	kind     webrtc.RTPCodecType
+	codec    webrtc.RTPCodecCapability
+	// simulcast is set when the publisher sends RID-based layers.
+	simulcast bool
+	// requestKeyFrame asks the publisher for a key frame on the given layer.
+	requestKeyFrame func(ssrc webrtc.SSRC)
+
+	mu       sync.Mutex
+	layers   map[string]*trackLayer
+	bindings map[webrtc.SSRC]*trackBinding
+	// sinks receive the track like subscribers do but outside of a
+	// PeerConnection, e.g. the room recorder. They're keyed by name.
+	sinks map[string]*trackBinding
+}
+
+type trackLayer struct {
+	rid  string
+	ssrc webrtc.SSRC
+	// bitrate is measured over the last complete window, in bits per second.
+	bitrate     uint64
+	windowStart time.Time
+	windowBytes int
+	lastPacket  time.Time
+	// lastKeyFrameRequest rate-limits requests for this layer.
+	lastKeyFrameRequest time.Time
+}
+
+type trackBinding struct {
+	ssrc        webrtc.SSRC
+	payloadType webrtc.PayloadType
+	writeStream webrtc.TrackLocalWriter
+
+	// preferred is the layer requested by the subscriber; when empty the
+	// layer is picked by estimate, the subscriber's share of bandwidth in
+	// bits per second (0 while unknown).
+	preferred string
+	estimate  uint64
+
+	// target is the layer to forward; current is forwarded until a key
+	// frame of target arrives.
+	target  string
+	current string
+	active  bool
+	// suspended stops forwarding while the estimate can't carry even the
+	// lowest layer.
+	suspended bool
+	// paused stops forwarding while the publisher is outside the
+	// subscriber's last N, see lastn.go.
+	paused bool
+
+	// fractionLost and jitter come from the subscriber's receiver reports.
+	fractionLost uint8
+	jitter       uint32
+	// nacks and keyFrameRequests count the subscriber's feedback.
+	nacks            uint64
+	keyFrameRequests uint64
+
+	sent      bool
+	seqOffset uint16
+	tsOffset  uint32
+	lastSeq   uint16
+	lastTS    uint32
+	lastWrite time.Time
+}
+
+func newForwardTrack(remote *webrtc.TrackRemote, requestKeyFrame func(webrtc.SSRC)) *forwardTrack {
+	track := &forwardTrack{
+		id:              remote.ID(),
+		streamID:        remote.StreamID(),
+		kind:            remote.Kind(),
+		codec:           remote.Codec().RTPCodecCapability,
+		simulcast:       remote.RID() != "",
+		requestKeyFrame: requestKeyFrame,
+		layers:          map[string]*trackLayer{},
+		bindings:        map[webrtc.SSRC]*trackBinding{},
+		sinks:           map[string]*trackBinding{},
+	}
+	track.addLayer(remote)
+
+	return track
+}
+
+// ID is the track ID of the publisher's track.
+func (f *forwardTrack) ID() string { return f.id }
+
+// RID is empty: subscribers always get a single encoding.
+func (f *forwardTrack) RID() string { return "" }
+
+// StreamID is the MediaStream ID of the publisher's track.
+func (f *forwardTrack) StreamID() string { return f.streamID }
+
+// Kind is audio or video.
+func (f *forwardTrack) Kind() webrtc.RTPCodecType { return f.kind }
+
+// Bind is called by pion when a subscriber's sender starts.
+func (f *forwardTrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, ok := matchCodec(f.codec, ctx.CodecParameters())
+	if !ok {
+		return webrtc.RTPCodecParameters{}, webrtc.ErrUnsupportedCodec
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	binding := f.bindingLocked(ctx.SSRC())
+	binding.payloadType = codec.PayloadType
+	binding.writeStream = ctx.WriteStream()
+	f.selectLayerLocked(binding)
+	if layer, ok := f.layers[binding.target]; ok && !binding.suspended && !binding.paused {
+		// Forwarding starts on a key frame, so don't wait for the next one
+		f.requestKeyFrameLocked(layer)
+	}
+
+	return codec, nil
+}
+
+// Unbind is called by pion when a subscriber's sender stops.
+func (f *forwardTrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.bindings, ctx.SSRC())
+
+	return nil
+}
+
+// bindingLocked returns the state of a subscriber, creating it if the
+// subscriber changed its preferences before the sender was bound.
+func (f *forwardTrack) bindingLocked(ssrc webrtc.SSRC) *trackBinding {
+	binding, ok := f.bindings[ssrc]
+	if !ok {
+		binding = &trackBinding{ssrc: ssrc}
+		f.bindings[ssrc] = binding
+	}
+
+	return binding
+}
+
+func (f *forwardTrack) addLayer(remote *webrtc.TrackRemote) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.layers[remote.RID()] = &trackLayer{rid: remote.RID(), ssrc: remote.SSRC()}
+	f.reselectLocked()
+}
+
+// addSink starts writing the track to writer. A sink has no estimate, so it
+// gets the highest layer and is never suspended.
+func (f *forwardTrack) addSink(name string, writer webrtc.TrackLocalWriter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sink := &trackBinding{writeStream: writer}
+	f.sinks[name] = sink
+	f.selectLayerLocked(sink)
+	if layer, ok := f.layers[sink.target]; ok {
+		f.requestKeyFrameLocked(layer)
+	}
+}
+
+// removeSink stops writing to a sink and returns its writer, if any.
+func (f *forwardTrack) removeSink(name string) webrtc.TrackLocalWriter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sink, ok := f.sinks[name]
+	if !ok {
+		return nil
+	}
+	delete(f.sinks, name)
+
+	return sink.writeStream
+}
+
+// reselectLocked updates the layer of every subscriber and sink. It must be
+// called with f.mu held.
+func (f *forwardTrack) reselectLocked() {
+	for _, binding := range f.bindings {
+		f.selectLayerLocked(binding)
+	}
+	for _, sink := range f.sinks {
+		f.selectLayerLocked(sink)
+	}
+}
+
+// removeLayer drops a layer whose remote track ended and returns how many
+// layers are left.
+func (f *forwardTrack) removeLayer(rid string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.layers, rid)
+	for _, binding := range f.bindings {
+		if binding.current == rid {
+			binding.active = false
+		}
+	}
+	for _, sink := range f.sinks {
+		if sink.current == rid {
+			sink.active = false
+		}
+	}
+	f.reselectLocked()
+
+	return len(f.layers)
+}
+
+// requestKeyFrameLocked asks the publisher for a key frame on the layer
+// unless one was requested recently. It must be called with f.mu held.
+func (f *forwardTrack) requestKeyFrameLocked(layer *trackLayer) {
+	if f.kind != webrtc.RTPCodecTypeVideo {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(layer.lastKeyFrameRequest) < minKeyFrameInterval {
+		return
+	}
+	layer.lastKeyFrameRequest = now
+
+	f.requestKeyFrame(layer.ssrc)
+}
+
+// requestKeyFrames asks for a key frame on every layer, e.g. after new
+// subscribers were added.
+func (f *forwardTrack) requestKeyFrames() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, layer := range f.layers {
+		f.requestKeyFrameLocked(layer)
+	}
+}
+
+// awaitKeyFrame holds forwarding to every subscriber and sink until the next
+// key frame of its target layer, e.g. when the publisher unmutes video and the
+// packets that follow are deltas of frames the subscribers never got. The key
+// frame is requested right away.
+func (f *forwardTrack) awaitKeyFrame() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, binding := range f.bindings {
+		binding.active = false
+	}
+	for _, sink := range f.sinks {
+		sink.active = false
+	}
+	for _, layer := range f.layers {
+		f.requestKeyFrameLocked(layer)
+	}
+}
+
+// keyFrameRequested forwards a PLI or FIR of a subscriber to the publisher
+// of the layer the subscriber is waiting for or receiving.
+func (f *forwardTrack) keyFrameRequested(ssrc webrtc.SSRC) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	binding, ok := f.bindings[ssrc]
+	if !ok {
+		return
+	}
+
+	binding.keyFrameRequests++
+	if binding.suspended || binding.paused {
+		return
+	}
+
+	if layer, ok := f.layers[binding.target]; ok {
+		f.requestKeyFrameLocked(layer)
+	}
+}
+
+// setPaused pauses or resumes forwarding to a subscriber without removing
+// the track, so no renegotiation is needed. A resumed subscriber waits for
+// a key frame, which is requested right away.
+func (f *forwardTrack) setPaused(ssrc webrtc.SSRC, paused bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	binding := f.bindingLocked(ssrc)
+	if binding.paused == paused {
+		return
+	}
+
+	binding.paused = paused
+	if paused {
+		binding.active = false
+
+		return
+	}
+
+	f.selectLayerLocked(binding)
+	if layer, ok := f.layers[binding.target]; ok && !binding.suspended {
+		f.requestKeyFrameLocked(layer)
+	}
+}
+
+// isPaused reports whether forwarding to a subscriber is paused.
+func (f *forwardTrack) isPaused(ssrc webrtc.SSRC) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	binding, ok := f.bindings[ssrc]
+
+	return ok && binding.paused
+}
+
+// rids lists the simulcast layers for presence events.
+func (f *forwardTrack) rids() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rids := make([]string, 0, len(f.layers))
+	for rid := range f.layers {
+		rids = append(rids, rid)
+	}
+	slices.Sort(rids)
+
+	return rids
+}
+
+// writeRTP forwards a packet of the given layer to every subscriber that
+// receives this layer. Subscribers start forwarding and switch to their
+// target layer on its next key frame.
+func (f *forwardTrack) writeRTP(rid string, packet *rtp.Packet) {
+	keyFrame := !canDetectKeyFrames(f.codec.MimeType) || isKeyFrame(f.codec.MimeType, packet.Payload)
+	now := time.Now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if layer, ok := f.layers[rid]; ok && layer.measure(now, len(packet.Payload)) {
+		// A new bitrate is known, so the best fitting layer may have changed
+		f.reselectLocked()
+	}
+
+	for _, binding := range f.bindings {
+		f.forwardLocked(binding, rid, packet, keyFrame, now)
+	}
+	for _, sink := range f.sinks {
+		f.forwardLocked(sink, rid, packet, keyFrame, now)
+	}
+}
+
+// forwardLocked writes a packet of the given layer to one subscriber or sink,
+// rewriting it into the subscriber's continuous stream. It must be called
+// with f.mu held.
+func (f *forwardTrack) forwardLocked(binding *trackBinding, rid string, packet *rtp.Packet, keyFrame bool, now time.Time) {
+	if binding.writeStream == nil || binding.suspended || binding.paused {
+		return
+	}
+
+	if !binding.active || rid != binding.current {
+		if rid != binding.target || !keyFrame {
+			return
+		}
+
+		binding.current, binding.active = rid, true
+		if binding.sent {
+			// Continue the subscriber's sequence and timeline where the
+			// previous layer stopped
+			elapsed := uint32(now.Sub(binding.lastWrite).Seconds() * float64(f.codec.ClockRate))
+			binding.seqOffset = binding.lastSeq + 1 - packet.SequenceNumber
+			binding.tsOffset = binding.lastTS + max(elapsed, 1) - packet.Timestamp
+		}
+	}
+
+	header := packet.Header
+	header.SSRC = uint32(binding.ssrc)
+	header.PayloadType = uint8(binding.payloadType)
+	header.SequenceNumber = packet.SequenceNumber + binding.seqOffset
+	header.Timestamp = packet.Timestamp + binding.tsOffset
+
+	if !binding.sent || int16(header.SequenceNumber-binding.lastSeq) > 0 {
+		binding.lastSeq, binding.lastTS, binding.lastWrite = header.SequenceNumber, header.Timestamp, now
+	}
+	binding.sent = true
+
+	if _, err := binding.writeStream.WriteRTP(&header, packet.Payload); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+		logging.Debugf("Failed to forward RTP packet: %v", err)
+	}
+}
+
+// measure accounts a packet and reports whether a bitrate window completed.
+func (l *trackLayer) measure(now time.Time, size int) bool {
+	l.lastPacket = now
+	if l.windowStart.IsZero() {
+		l.windowStart = now
+	}
+	l.windowBytes += size
+
+	elapsed := now.Sub(l.windowStart)
+	if elapsed < bitrateWindow {
+		return false
+	}
+
+	l.bitrate = uint64(float64(l.windowBytes*8) / elapsed.Seconds())
+	l.windowStart, l.windowBytes = now, 0
+
+	return true
+}
+
+// matchCodec finds the negotiated codec matching the publisher's codec,
+// preferring an identical fmtp line.
+func matchCodec(codec webrtc.RTPCodecCapability, negotiated []webrtc.RTPCodecParameters) (webrtc.RTPCodecParameters, bool) {
+	for _, c := range negotiated {
+		if strings.EqualFold(c.MimeType, codec.MimeType) && c.SDPFmtpLine == codec.SDPFmtpLine {
+			return c, true
+		}
+	}
+
+	for _, c := range negotiated {
+		if strings.EqualFold(c.MimeType, codec.MimeType) && c.ClockRate == codec.ClockRate {
+			return c, true
+		}
+	}
+
+	return webrtc.RTPCodecParameters{}, false
+}
@@ -0,0 +1,51 @@
+package signaling
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Coderovshik/meet/internal/auth"
+)
+
+// identity is who is connecting: a registered user or a guest admitted by
+// an invite link.
+type identity struct {
+	username    string
+	displayName string
+	// session is set when a registered user authenticated with a session
+	// token rather than a password.
+	session bool
+	// invite is set for guests only.
+	invite *auth.Invite
+}
+
+func (who identity) guest() bool {
+	return who.invite != nil
+}
+
+func (peer *peerConnectionState) identity() identity {
+	return identity{username: peer.username, displayName: peer.displayName, invite: peer.invite}
+}
+
+// credentialsOwner is the account TURN credentials are issued for. Guests
+// have no session of their own, so they relay through their inviter's. Users
+// who signed in with a password get none: the TURN server only accepts
+// credentials of accounts with an active session.
+func (who identity) credentialsOwner() (string, bool) {
+	if who.guest() {
+		return who.invite.Inviter, true
+	}
+
+	return who.username, who.session
+}
+
+// addLog records an action in the user's journal. Guests have no journal of
+// their own, so their actions go to the host who invited them.
+func (who identity) addLog(ctx context.Context, logStore *auth.LogStore, action, details string) error {
+	if !who.guest() {
+		return logStore.AddLog(ctx, who.username, action, details)
+	}
+
+	return logStore.AddLog(ctx, who.invite.Inviter, "guest_"+action,
+		fmt.Sprintf("Guest: %s (%s), Invite: %s, %s", who.displayName, who.username, who.invite.ID, details))
+}
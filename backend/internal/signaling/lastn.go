@@ -0,0 +1,240 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Coderovshik/meet/internal/auth"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var errPeerNotFound = errors.New("participant not found")
+
+type setLastNPayload struct {
+	// N is how many recent speakers' video each participant receives; 0
+	// forwards every video.
+	N int `json:"n"`
+}
+
+type pinPayload struct {
+	ParticipantID string `json:"participant_id"`
+	// Pinned false unpins the participant.
+	Pinned bool `json:"pinned"`
+}
+
+// lastNPayload tells a participant whose video it receives.
+type lastNPayload struct {
+	N int `json:"n"`
+	// Forwarded lists the publishers whose video is forwarded, most recent
+	// speaker first and pinned ones last; nil while every video is.
+	Forwarded []string `json:"forwarded"`
+	Pinned    []string `json:"pinned"`
+}
+
+// setLastN changes the room's policy and applies it to every participant.
+func (room *Room) setLastN(n int) {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	if room.lastN == n {
+		return
+	}
+	room.lastN = n
+	room.applyLastNLocked(&out)
+}
+
+// notifySpeakerChanged wakes up watchSpeakers without blocking the RTP read
+// loop that noticed the change. Wake-ups coalesce: watchSpeakers reads the
+// current speaker, so only the latest change matters.
+func (room *Room) notifySpeakerChanged() {
+	select {
+	case room.speakerChanges <- struct{}{}:
+	default:
+	}
+}
+
+// watchSpeakers applies speaker changes until the room is dropped. It runs on
+// its own goroutine so a slow WebSocket never stalls media forwarding.
+func (room *Room) watchSpeakers() {
+	for {
+		select {
+		case <-room.speakerChanges:
+			room.speakerChanged(room.speakers.current())
+		case <-room.done:
+			return
+		}
+	}
+}
+
+// speakerChanged announces a new dominant speaker and moves it to the front
+// of the last N.
+func (room *Room) speakerChanged(id string) {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	if id == "" || room.findPeerLocked(id) == nil {
+		// The speaker left before the change was applied, removePeerLocked
+		// already announced the new one
+		return
+	}
+
+	room.broadcastLocked(&out, "active_speaker", &activeSpeakerPayload{ID: id}, "")
+	room.promoteSpeakerLocked(id)
+	room.applyLastNLocked(&out)
+}
+
+func (room *Room) promoteSpeakerLocked(id string) {
+	if id == "" {
+		return
+	}
+
+	room.speakerOrder = slices.DeleteFunc(room.speakerOrder, func(other string) bool { return other == id })
+	room.speakerOrder = slices.Insert(room.speakerOrder, 0, id)
+}
+
+// setPinned pins or unpins a publisher for one participant. Pinned video is
+// forwarded regardless of the last N.
+func (room *Room) setPinned(id, publisherID string, pinned bool) error {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	peer := room.findPeerLocked(id)
+	if peer == nil || (pinned && room.findPeerLocked(publisherID) == nil) {
+		return errPeerNotFound
+	}
+
+	if pinned {
+		peer.pins[publisherID] = true
+	} else {
+		delete(peer.pins, publisherID)
+	}
+	room.applyLastNLocked(&out)
+
+	return nil
+}
+
+// forwardedLocked returns the publishers whose video a participant receives,
+// or nil when the room has no last N. Only publishers with video take a
+// slot. It must be called with listLock held.
+func (room *Room) forwardedLocked(peer *peerConnectionState) []string {
+	if room.lastN <= 0 {
+		return nil
+	}
+
+	publishing := map[string]bool{}
+	for trackID, track := range room.trackLocals {
+		if track.Kind() == webrtc.RTPCodecTypeVideo {
+			publishing[room.trackOwners[trackID]] = true
+		}
+	}
+
+	forwarded := []string{}
+	for _, id := range room.speakerOrder {
+		if len(forwarded) == room.lastN {
+			break
+		}
+		if id != peer.id && publishing[id] {
+			forwarded = append(forwarded, id)
+		}
+	}
+
+	pins := make([]string, 0, len(peer.pins))
+	for id := range peer.pins {
+		pins = append(pins, id)
+	}
+	slices.Sort(pins)
+	for _, id := range pins {
+		if !slices.Contains(forwarded, id) {
+			forwarded = append(forwarded, id)
+		}
+	}
+
+	return forwarded
+}
+
+// applyLastNLocked pauses and resumes the video each participant receives
+// according to the last N and its pins, and tells participants whose set
+// changed. It must be called with listLock held for writing.
+func (room *Room) applyLastNLocked(out *outbox) {
+	for i := range room.peerConnections {
+		peer := &room.peerConnections[i]
+
+		forwarded := room.forwardedLocked(peer)
+		for _, sender := range peer.peerConnection.GetSenders() {
+			track, ok := sender.Track().(*forwardTrack)
+			if !ok || track.Kind() != webrtc.RTPCodecTypeVideo {
+				continue
+			}
+
+			encodings := sender.GetParameters().Encodings
+			if len(encodings) == 0 {
+				continue
+			}
+
+			paused := forwarded != nil && !slices.Contains(forwarded, room.trackOwners[track.ID()])
+			track.setPaused(encodings[0].SSRC, paused)
+		}
+
+		if slices.Equal(forwarded, peer.forwarded) && (forwarded == nil) == (peer.forwarded == nil) {
+			continue
+		}
+		peer.forwarded = forwarded
+
+		pins := make([]string, 0, len(peer.pins))
+		for id := range peer.pins {
+			pins = append(pins, id)
+		}
+		slices.Sort(pins)
+
+		out.add(peer.websocket, "last_n", &lastNPayload{N: room.lastN, Forwarded: forwarded, Pinned: pins})
+
+		// Shares of the remaining video tracks changed
+		go peer.bandwidth.allocate()
+	}
+}
+
+func (sc *signalingClient) handleSetLastN(message *websocketMessage) error {
+	if err := sc.requireModerator(); err != nil {
+		return err
+	}
+
+	payload := setLastNPayload{}
+	if err := message.decode(&payload); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	if _, err := sc.roomStore.SetLastN(sc.ctx, sc.room.ID(), payload.N); errors.Is(err, auth.ErrInvalidLastN) {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	} else if err != nil {
+		return internalError(err)
+	}
+
+	sc.room.setLastN(payload.N)
+	sc.logAction(sc.identity, "room_last_n_changed", fmt.Sprintf("Room: %s, N: %d", sc.room.ID(), payload.N))
+
+	return nil
+}
+
+func (sc *signalingClient) handlePin(message *websocketMessage) error {
+	payload := pinPayload{}
+	if err := message.decode(&payload); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+	if payload.ParticipantID == "" || payload.ParticipantID == sc.participantID {
+		return newProtocolError(errCodeInvalidPayload, "participant_id must be another participant")
+	}
+
+	if err := sc.room.setPinned(sc.participantID, payload.ParticipantID, payload.Pinned); err != nil {
+		return newProtocolError(errCodeNotFound, "participant not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package signaling
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// FuzzLastN проверяет выбор пересылаемого видео: не больше N докладчиков
+// плюс закрепленные участники, без собственного видео получателя
+func FuzzLastN(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add(uint8(2), []byte{0, 1, 2, 3}, []byte{3, 1}, uint8(0b1011), uint8(0b0100))
+	f.Add(uint8(0), []byte{0, 1}, []byte{1}, uint8(0b11), uint8(0b10))
+	f.Add(uint8(1), []byte{}, []byte{5, 5, 5}, uint8(0xff), uint8(0xff))
+	f.Add(uint8(8), []byte{7, 6, 5, 4, 3, 2, 1, 0}, []byte{}, uint8(0), uint8(0x80))
+
+	f.Fuzz(func(t *testing.T, n uint8, participants, speakers []byte, video, pins uint8) {
+		room := newRoom("room", nil)
+		room.lastN = int(n % 10)
+
+		for _, p := range participants {
+			id := strconv.Itoa(int(p % 8))
+			if room.findPeerLocked(id) != nil {
+				continue
+			}
+			room.peerConnections = append(room.peerConnections, peerConnectionState{id: id, pins: map[string]bool{}})
+			room.speakerOrder = append(room.speakerOrder, id)
+
+			if video&(1<<(p%8)) != 0 {
+				room.trackLocals["video-"+id] = &forwardTrack{id: "video-" + id, kind: webrtc.RTPCodecTypeVideo}
+				room.trackOwners["video-"+id] = id
+			}
+		}
+		for _, s := range speakers {
+			room.promoteSpeakerLocked(strconv.Itoa(int(s % 8)))
+		}
+		if len(room.peerConnections) == 0 {
+			return
+		}
+
+		peer := &room.peerConnections[0]
+		for i := range 8 {
+			if id := strconv.Itoa(i); pins&(1<<i) != 0 && id != peer.id && room.findPeerLocked(id) != nil {
+				peer.pins[id] = true
+			}
+		}
+
+		forwarded := room.forwardedLocked(peer)
+		if room.lastN == 0 {
+			if forwarded != nil {
+				t.Fatalf("Без ограничения пересылается %v вместо всего видео", forwarded)
+			}
+			return
+		}
+
+		slots := 0
+		for i, id := range forwarded {
+			if id == peer.id {
+				t.Fatalf("Получателю пересылается его собственное видео: %v", forwarded)
+			}
+			if slices.Contains(forwarded[i+1:], id) {
+				t.Fatalf("Участник %s повторяется в %v", id, forwarded)
+			}
+			if !peer.pins[id] {
+				slots++
+				if room.trackLocals["video-"+id] == nil {
+					t.Fatalf("Слот занят участником %s без видео", id)
+				}
+			}
+		}
+		if slots > room.lastN {
+			t.Fatalf("Пересылается %d докладчиков при N = %d", slots, room.lastN)
+		}
+		for id := range peer.pins {
+			if !slices.Contains(forwarded, id) {
+				t.Fatalf("Закрепленный участник %s не пересылается: %v", id, forwarded)
+			}
+		}
+	})
+}
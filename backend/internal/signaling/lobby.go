@@ -0,0 +1,314 @@
+package signaling
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/logging"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxCloseReason is the longest reason that fits into a WebSocket close frame.
+const maxCloseReason = 123
+
+// noModeratorReason turns away waiters once nobody is left to admit them.
+const noModeratorReason = "no host or co-host left in the room"
+
+// lobbyEntry is a connection waiting for admission. Its WebSocket is open but
+// no PeerConnection is attached to the room yet.
+type lobbyEntry struct {
+	id string
+	identity
+	websocket *threadSafeWriter
+	// decision receives exactly one value; it is buffered so moderators never block.
+	decision chan lobbyDecision
+}
+
+type lobbyDecision struct {
+	admitted bool
+	by       string
+	reason   string
+}
+
+type knockPayload struct {
+	ParticipantID string `json:"participant_id"`
+	Username      string `json:"username"`
+	DisplayName   string `json:"display_name"`
+}
+
+func (entry *lobbyEntry) knock() *knockPayload {
+	return &knockPayload{ParticipantID: entry.id, Username: entry.username, DisplayName: entry.displayName}
+}
+
+// knockResolvedPayload tells moderators that a knock is no longer pending.
+// Result is "admitted", "denied" or "left".
+type knockResolvedPayload struct {
+	ParticipantID string `json:"participant_id"`
+	Result        string `json:"result"`
+	By            string `json:"by,omitempty"`
+}
+
+type lobbyWaitingPayload struct {
+	ParticipantID string `json:"participant_id"`
+}
+
+type lobbyDecisionPayload struct {
+	ParticipantID string `json:"participant_id"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+type lobbyDeniedPayload struct {
+	By     string `json:"by"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type setLobbyPayload struct {
+	Enabled bool `json:"enabled"`
+}
+
+type lobbyChangedPayload struct {
+	Enabled bool   `json:"enabled"`
+	By      string `json:"by"`
+}
+
+func (room *Room) enterLobby(entry *lobbyEntry) {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	room.lobby[entry.id] = entry
+	room.sendToModeratorsLocked(&out, "knock", entry.knock())
+}
+
+// leaveLobby drops an entry that left before a decision was made.
+func (room *Room) leaveLobby(id string) {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	if _, ok := room.lobby[id]; ok {
+		delete(room.lobby, id)
+		room.sendToModeratorsLocked(&out, "knock_resolved", &knockResolvedPayload{ParticipantID: id, Result: "left"})
+	}
+}
+
+// decideLobby admits or denies a waiting connection and returns who it was.
+func (room *Room) decideLobby(id string, decision lobbyDecision) (identity, error) {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	entry, ok := room.lobby[id]
+	if !ok {
+		return identity{}, errParticipantNotFound
+	}
+
+	room.resolveLobbyLocked(&out, entry, decision)
+
+	return entry.identity, nil
+}
+
+// admitAll lets everyone waiting in the lobby in.
+func (room *Room) admitAll(by string) []identity {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	admitted := make([]identity, 0, len(room.lobby))
+	for _, entry := range room.lobby {
+		room.resolveLobbyLocked(&out, entry, lobbyDecision{admitted: true, by: by})
+		admitted = append(admitted, entry.identity)
+	}
+
+	return admitted
+}
+
+func (room *Room) resolveLobbyLocked(out *outbox, entry *lobbyEntry, decision lobbyDecision) {
+	delete(room.lobby, entry.id)
+	entry.decision <- decision
+
+	result := "denied"
+	if decision.admitted {
+		result = "admitted"
+	}
+	room.sendToModeratorsLocked(out, "knock_resolved", &knockResolvedPayload{
+		ParticipantID: entry.id,
+		Result:        result,
+		By:            decision.by,
+	})
+}
+
+// denyLobbyWithoutModeratorLocked turns away everyone waiting in the lobby
+// once the last participant who could admit them left or was demoted,
+// instead of leaving them parked. It must be called with listLock held for
+// writing.
+func (room *Room) denyLobbyWithoutModeratorLocked(out *outbox) {
+	if len(room.lobby) == 0 {
+		return
+	}
+	for i := range room.peerConnections {
+		if auth.CanModerate(room.peerConnections[i].role) {
+			return
+		}
+	}
+
+	for _, entry := range room.lobby {
+		room.resolveLobbyLocked(out, entry, lobbyDecision{reason: noModeratorReason})
+	}
+}
+
+// sendToModeratorsLocked queues an event for the hosts and co-hosts. It must
+// be called with listLock held.
+func (room *Room) sendToModeratorsLocked(out *outbox, event string, payload any) {
+	for i := range room.peerConnections {
+		if auth.CanModerate(room.peerConnections[i].role) {
+			out.add(room.peerConnections[i].websocket, event, payload)
+		}
+	}
+}
+
+// waitInLobby parks the connection until a moderator decides about it. Only
+// the handshake is served meanwhile. It returns true once admitted.
+func (sc *signalingClient) waitInLobby(incoming <-chan []byte) bool {
+	entry := &lobbyEntry{
+		id:        sc.participantID,
+		identity:  sc.identity,
+		websocket: sc.websocket,
+		decision:  make(chan lobbyDecision, 1),
+	}
+	sc.room.enterLobby(entry)
+	defer sc.room.leaveLobby(entry.id)
+
+	if err := sc.websocket.send("lobby_waiting", &lobbyWaitingPayload{ParticipantID: entry.id}); err != nil {
+		return false
+	}
+
+	handle := func(message *websocketMessage) error {
+		if message.Event == "hello" {
+			return sc.handleHello(message)
+		}
+
+		return newProtocolError(errCodeForbidden, "waiting for admission")
+	}
+
+	for {
+		select {
+		case raw, ok := <-incoming:
+			if !ok || !sc.process(raw, handle) {
+				return false
+			}
+		case decision := <-entry.decision:
+			if decision.admitted {
+				return sc.websocket.send("lobby_admitted", &moderationPayload{By: decision.by}) == nil
+			}
+
+			if decision.by == "" {
+				// Nobody denied it, so no moderator's handler logged it
+				sc.logAction(sc.identity, "lobby_denied", fmt.Sprintf("Room: %s, Reason: %s", sc.room.ID(), decision.reason))
+			}
+			if err := sc.websocket.send("lobby_denied", &lobbyDeniedPayload{
+				By:     decision.by,
+				Reason: decision.reason,
+			}); err != nil {
+				return false
+			}
+			if err := sc.websocket.closeWithReason(websocket.ClosePolicyViolation, decision.reason); err != nil {
+				logging.Debugf("Failed to send close frame: %v", err)
+			}
+
+			return false
+		}
+	}
+}
+
+func (sc *signalingClient) handleAdmit(message *websocketMessage) error {
+	return sc.decide(message, true)
+}
+
+func (sc *signalingClient) handleDeny(message *websocketMessage) error {
+	return sc.decide(message, false)
+}
+
+func (sc *signalingClient) decide(message *websocketMessage, admitted bool) error {
+	if err := sc.requireModerator(); err != nil {
+		return err
+	}
+
+	payload := lobbyDecisionPayload{}
+	if err := message.decode(&payload); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	reason := payload.Reason
+	if admitted {
+		reason = ""
+	} else if reason == "" {
+		reason = "denied by host"
+	}
+	if !utf8.ValidString(reason) {
+		return newProtocolError(errCodeInvalidPayload, "reason must be valid UTF-8")
+	}
+	for len(reason) > maxCloseReason {
+		_, size := utf8.DecodeLastRuneInString(reason)
+		reason = reason[:len(reason)-size]
+	}
+
+	who, err := sc.room.decideLobby(payload.ParticipantID, lobbyDecision{
+		admitted: admitted,
+		by:       sc.username,
+		reason:   reason,
+	})
+	if err != nil {
+		return newProtocolError(errCodeNotFound, "no such knock")
+	}
+
+	if admitted {
+		sc.logAction(who, "lobby_admitted", fmt.Sprintf("Room: %s, By: %s", sc.room.ID(), sc.username))
+	} else {
+		sc.logAction(who, "lobby_denied", fmt.Sprintf("Room: %s, By: %s, Reason: %s", sc.room.ID(), sc.username, reason))
+	}
+
+	return nil
+}
+
+func (sc *signalingClient) handleSetLobby(message *websocketMessage) error {
+	if err := sc.requireModerator(); err != nil {
+		return err
+	}
+
+	payload := setLobbyPayload{}
+	if err := message.decode(&payload); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	if _, err := sc.roomStore.SetLobby(sc.ctx, sc.room.ID(), payload.Enabled); err != nil {
+		return internalError(err)
+	}
+
+	sc.room.broadcast("lobby_changed", &lobbyChangedPayload{Enabled: payload.Enabled, By: sc.username})
+
+	// Без зала ожидания ждать больше некого
+	if !payload.Enabled {
+		for _, who := range sc.room.admitAll(sc.username) {
+			sc.logAction(who, "lobby_admitted", fmt.Sprintf("Room: %s, By: %s", sc.room.ID(), sc.username))
+		}
+	}
+
+	return nil
+}
+
+// closeWithReason sends a close frame so the client can show why it was
+// disconnected.
+func (t *threadSafeWriter) closeWithReason(code int, reason string) error {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
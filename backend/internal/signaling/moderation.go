@@ -0,0 +1,250 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/logging"
+)
+
+type participantTargetPayload struct {
+	ParticipantID string `json:"participant_id"`
+}
+
+type setRolePayload struct {
+	ParticipantID string `json:"participant_id"`
+	Role          string `json:"role"`
+}
+
+type lockRoomPayload struct {
+	Locked bool `json:"locked"`
+}
+
+type roomLockedPayload struct {
+	Locked bool   `json:"locked"`
+	By     string `json:"by"`
+}
+
+// moderationPayload is sent to participants removed by a moderator.
+type moderationPayload struct {
+	By string `json:"by"`
+}
+
+// participantRef is a snapshot of a participant taken under listLock.
+type participantRef struct {
+	id string
+	identity
+	role string
+}
+
+func (room *Room) lookupPeer(id string) (participantRef, bool) {
+	room.listLock.RLock()
+	defer room.listLock.RUnlock()
+
+	peer := room.findPeerLocked(id)
+	if peer == nil {
+		return participantRef{}, false
+	}
+
+	return participantRef{id: peer.id, identity: peer.identity(), role: peer.role}, true
+}
+
+// setUserRole applies a new role to every connection of the user.
+func (room *Room) setUserRole(username, role string) {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	for i := range room.peerConnections {
+		peer := &room.peerConnections[i]
+		if peer.username != username {
+			continue
+		}
+
+		peer.role = role
+		peer.media.viewOnly.Store(role == auth.RoleViewer)
+		room.announceUpdateLocked(&out, peer.id)
+	}
+	if !auth.CanModerate(role) {
+		room.denyLobbyWithoutModeratorLocked(&out)
+	}
+}
+
+// disconnectUser sends event to every connection of the user and closes
+// their PeerConnections and WebSockets. The connection handlers then leave
+// the room as usual.
+func (room *Room) disconnectUser(username, event string, payload any) {
+	var out outbox
+	var peers []peerConnectionState
+	room.listLock.Lock()
+	for i := range room.peerConnections {
+		if room.peerConnections[i].username == username {
+			out.add(room.peerConnections[i].websocket, event, payload)
+			peers = append(peers, room.peerConnections[i])
+		}
+	}
+	room.listLock.Unlock()
+
+	out.send()
+	closePeers(peers)
+}
+
+// closePeers tears down the PeerConnections and WebSockets of peers. It must
+// be called without listLock, after their last messages were sent.
+func closePeers(peers []peerConnectionState) {
+	for i := range peers {
+		if err := peers[i].peerConnection.Close(); err != nil {
+			logging.Errorf("Failed to close PeerConnection: %v", err)
+		}
+		peers[i].websocket.Close()
+	}
+}
+
+func (room *Room) broadcast(event string, payload any) {
+	var out outbox
+	room.listLock.RLock()
+	defer out.send()
+	defer room.listLock.RUnlock()
+
+	room.broadcastLocked(&out, event, payload, "")
+}
+
+// role returns the current role of the sender.
+func (sc *signalingClient) role() string {
+	self, _ := sc.room.lookupPeer(sc.participantID)
+
+	return self.role
+}
+
+// requireModerator fails unless the sender is a host or co-host.
+func (sc *signalingClient) requireModerator() error {
+	if !auth.CanModerate(sc.role()) {
+		return newProtocolError(errCodeForbidden, "only hosts and co-hosts can do this")
+	}
+
+	return nil
+}
+
+// moderationTarget checks that the sender may moderate the participant the
+// message targets and returns it. Co-hosts can only act on participants and
+// viewers, nobody can act on the host or on themselves.
+func (sc *signalingClient) moderationTarget(message *websocketMessage) (participantRef, error) {
+	if err := sc.requireModerator(); err != nil {
+		return participantRef{}, err
+	}
+
+	payload := participantTargetPayload{}
+	if err := message.decode(&payload); err != nil {
+		return participantRef{}, newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	target, ok := sc.room.lookupPeer(payload.ParticipantID)
+	if !ok {
+		return participantRef{}, newProtocolError(errCodeNotFound, errParticipantNotFound.Error())
+	}
+	if target.username == sc.username {
+		return participantRef{}, newProtocolError(errCodeForbidden, "cannot moderate yourself")
+	}
+	if target.role == auth.RoleHost || (target.role == auth.RoleCoHost && sc.role() != auth.RoleHost) {
+		return participantRef{}, newProtocolError(errCodeForbidden, "cannot moderate a "+target.role)
+	}
+
+	return target, nil
+}
+
+func (sc *signalingClient) handleSetRole(message *websocketMessage) error {
+	target, err := sc.moderationTarget(message)
+	if err != nil {
+		return err
+	}
+
+	payload := setRolePayload{}
+	if err := message.decode(&payload); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+	if payload.Role == auth.RoleCoHost && sc.role() != auth.RoleHost {
+		return newProtocolError(errCodeForbidden, "only the host can appoint co-hosts")
+	}
+
+	err = sc.roomStore.SetRole(sc.ctx, sc.room.ID(), target.username, payload.Role)
+	if errors.Is(err, auth.ErrInvalidRole) {
+		return newProtocolError(errCodeInvalidPayload, "role must be co_host, participant or viewer")
+	} else if err != nil {
+		return internalError(err)
+	}
+
+	sc.room.setUserRole(target.username, payload.Role)
+	sc.logAction(target.identity, "room_role_changed",
+		fmt.Sprintf("Room: %s, Role: %s, By: %s", sc.room.ID(), payload.Role, sc.username))
+
+	return nil
+}
+
+func (sc *signalingClient) handleKick(message *websocketMessage) error {
+	target, err := sc.moderationTarget(message)
+	if err != nil {
+		return err
+	}
+
+	sc.room.disconnectUser(target.username, "kicked", &moderationPayload{By: sc.username})
+	sc.logAction(target.identity, "room_kicked", fmt.Sprintf("Room: %s, By: %s", sc.room.ID(), sc.username))
+
+	return nil
+}
+
+func (sc *signalingClient) handleBan(message *websocketMessage) error {
+	target, err := sc.moderationTarget(message)
+	if err != nil {
+		return err
+	}
+
+	// A guest comes back under a new name, so the ban goes on the invite.
+	if target.guest() {
+		err = sc.roomStore.BanInvite(sc.ctx, sc.room.ID(), target.invite.ID)
+	} else {
+		err = sc.roomStore.BanUser(sc.ctx, sc.room.ID(), target.username)
+	}
+	if err != nil {
+		return internalError(err)
+	}
+
+	sc.room.disconnectUser(target.username, "banned", &moderationPayload{By: sc.username})
+	sc.logAction(target.identity, "room_banned", fmt.Sprintf("Room: %s, By: %s", sc.room.ID(), sc.username))
+
+	return nil
+}
+
+func (sc *signalingClient) handleLockRoom(message *websocketMessage) error {
+	if err := sc.requireModerator(); err != nil {
+		return err
+	}
+
+	payload := lockRoomPayload{}
+	if err := message.decode(&payload); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	if _, err := sc.roomStore.SetLocked(sc.ctx, sc.room.ID(), payload.Locked); err != nil {
+		return internalError(err)
+	}
+
+	sc.room.broadcast("room_locked", &roomLockedPayload{Locked: payload.Locked, By: sc.username})
+
+	action := "room_unlocked"
+	if payload.Locked {
+		action = "room_locked"
+	}
+	sc.logAction(sc.identity, action, "Room: "+sc.room.ID())
+
+	return nil
+}
+
+// logAction records a moderation action in the journal of the affected user,
+// or of the inviter when it is a guest.
+func (sc *signalingClient) logAction(who identity, action, details string) {
+	if err := who.addLog(sc.ctx, sc.logStore, action, details); err != nil {
+		logging.Errorf("Ошибка при логировании действия %s: %v", action, err)
+	}
+}
@@ -0,0 +1,186 @@
+package signaling
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/Coderovshik/meet/internal/logging"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// mediaState holds the mute flags of one participant. It is read by the
+// forwarding loops for every RTP packet, so the flags are atomic.
+type mediaState struct {
+	audioMuted atomic.Bool
+	videoMuted atomic.Bool
+	forceMuted atomic.Bool
+	// viewOnly is set for viewers, who may watch but not publish.
+	viewOnly atomic.Bool
+}
+
+// paused reports whether packets of the given kind must not be forwarded.
+func (m *mediaState) paused(kind webrtc.RTPCodecType) bool {
+	if m.viewOnly.Load() {
+		return true
+	}
+
+	switch kind {
+	case webrtc.RTPCodecTypeAudio:
+		return m.audioMuted.Load() || m.forceMuted.Load()
+	case webrtc.RTPCodecTypeVideo:
+		return m.videoMuted.Load()
+	default:
+		return false
+	}
+}
+
+type mutePayload struct {
+	Kind  string `json:"kind"`
+	Muted bool   `json:"muted"`
+}
+
+type unmuteRequestedPayload struct {
+	By string `json:"by"`
+}
+
+var (
+	errParticipantNotFound = errors.New("participant not found")
+	errForceMuted          = errors.New("audio is muted by a moderator")
+)
+
+// setMuted applies a participant's own mute state for the given kind.
+func (room *Room) setMuted(id string, kind webrtc.RTPCodecType, muted bool) error {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	peer := room.findPeerLocked(id)
+	if peer == nil {
+		return errParticipantNotFound
+	}
+
+	switch kind {
+	case webrtc.RTPCodecTypeAudio:
+		if !muted && peer.media.forceMuted.Load() {
+			return errForceMuted
+		}
+		peer.media.audioMuted.Store(muted)
+	case webrtc.RTPCodecTypeVideo:
+		if !muted {
+			// Subscribers can't decode the stream mid-GOP, so forwarding
+			// resumes on a fresh key frame. The bindings are reset before
+			// the flag is cleared, so no delta frame slips through.
+			room.awaitKeyFramesLocked(id)
+		}
+		peer.media.videoMuted.Store(muted)
+	}
+
+	room.announceUpdateLocked(&out, id)
+
+	return nil
+}
+
+// forceMute pauses or resumes forwarding of the participant's audio
+// regardless of its own mute state.
+func (room *Room) forceMute(id string, muted bool) error {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	peer := room.findPeerLocked(id)
+	if peer == nil {
+		return errParticipantNotFound
+	}
+
+	peer.media.forceMuted.Store(muted)
+	room.announceUpdateLocked(&out, id)
+
+	return nil
+}
+
+// requestUnmute lifts a forced mute and asks the participant to unmute.
+// The participant decides whether to actually turn the microphone on.
+func (room *Room) requestUnmute(id, by string) error {
+	var out outbox
+	room.listLock.Lock()
+	defer out.send()
+	defer room.listLock.Unlock()
+
+	peer := room.findPeerLocked(id)
+	if peer == nil {
+		return errParticipantNotFound
+	}
+
+	if peer.media.forceMuted.Swap(false) {
+		room.announceUpdateLocked(&out, id)
+	}
+	out.add(peer.websocket, "unmute_requested", &unmuteRequestedPayload{By: by})
+
+	return nil
+}
+
+// awaitKeyFramesLocked holds forwarding of the video tracks published by the
+// participant until their next key frames. It must be called with listLock
+// held.
+func (room *Room) awaitKeyFramesLocked(ownerID string) {
+	for trackID, trackLocal := range room.trackLocals {
+		if room.trackOwners[trackID] == ownerID && trackLocal.Kind() == webrtc.RTPCodecTypeVideo {
+			trackLocal.awaitKeyFrame()
+		}
+	}
+}
+
+func (sc *signalingClient) handleMute(message *websocketMessage) error {
+	payload := mutePayload{}
+	if err := message.decode(&payload); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+
+	kind := webrtc.NewRTPCodecType(payload.Kind)
+	if kind == 0 {
+		return newProtocolError(errCodeInvalidPayload, "kind must be audio or video")
+	}
+
+	if err := sc.room.setMuted(sc.participantID, kind, payload.Muted); errors.Is(err, errForceMuted) {
+		return newProtocolError(errCodeForbidden, err.Error())
+	} else if err != nil {
+		return newProtocolError(errCodeNotFound, err.Error())
+	}
+
+	return nil
+}
+
+func (sc *signalingClient) handleForceMute(message *websocketMessage) error {
+	target, err := sc.moderationTarget(message)
+	if err != nil {
+		return err
+	}
+
+	if err := sc.room.forceMute(target.id, true); err != nil {
+		return newProtocolError(errCodeNotFound, err.Error())
+	}
+
+	logging.Infof("%s force-muted %s in room %s", sc.username, target.username, sc.room.ID())
+
+	return nil
+}
+
+func (sc *signalingClient) handleRequestUnmute(message *websocketMessage) error {
+	target, err := sc.moderationTarget(message)
+	if err != nil {
+		return err
+	}
+
+	err = sc.room.requestUnmute(target.id, sc.username)
+	switch {
+	case errors.Is(err, errParticipantNotFound):
+		return newProtocolError(errCodeNotFound, err.Error())
+	case err != nil:
+		logging.Warnf("Failed to send unmute request: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package signaling
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+
+	"github.com/Coderovshik/meet/internal/logging"
+)
+
+// participantInfo describes a participant in presence events. StreamIDs are
+// the MediaStream IDs of its tracks as the other participants receive them,
+// so clients can label video tiles.
+type participantInfo struct {
+	ID          string   `json:"id"`
+	Username    string   `json:"username"`
+	DisplayName string   `json:"display_name"`
+	Guest       bool     `json:"guest"`
+	Role        string   `json:"role"`
+	StreamIDs   []string `json:"stream_ids"`
+	// Simulcast maps the IDs of simulcast tracks to the RIDs of their layers.
+	Simulcast map[string][]string `json:"simulcast,omitempty"`
+
+	AudioMuted bool `json:"audio_muted"`
+	VideoMuted bool `json:"video_muted"`
+	// ForceMuted is set while a moderator keeps the audio muted server-side.
+	ForceMuted bool `json:"force_muted"`
+}
+
+type participantListPayload struct {
+	// Self is the ID of the participant receiving the list.
+	Self         string            `json:"self"`
+	Participants []participantInfo `json:"participants"`
+}
+
+func newParticipantID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// participantInfoLocked must be called with listLock held.
+func (room *Room) participantInfoLocked(peer *peerConnectionState) participantInfo {
+	streamIDs := []string{}
+	var simulcast map[string][]string
+	for trackID, ownerID := range room.trackOwners {
+		if ownerID != peer.id {
+			continue
+		}
+		trackLocal := room.trackLocals[trackID]
+		if streamID := trackLocal.StreamID(); !slices.Contains(streamIDs, streamID) {
+			streamIDs = append(streamIDs, streamID)
+		}
+		if trackLocal.simulcast {
+			if simulcast == nil {
+				simulcast = map[string][]string{}
+			}
+			simulcast[trackID] = trackLocal.rids()
+		}
+	}
+	slices.Sort(streamIDs)
+
+	return participantInfo{
+		ID:          peer.id,
+		Username:    peer.username,
+		DisplayName: peer.displayName,
+		Guest:       peer.invite != nil,
+		Role:        peer.role,
+		StreamIDs:   streamIDs,
+		Simulcast:   simulcast,
+		AudioMuted:  peer.media.audioMuted.Load(),
+		VideoMuted:  peer.media.videoMuted.Load(),
+		ForceMuted:  peer.media.forceMuted.Load(),
+	}
+}
+
+// broadcastLocked queues an event for every participant except exceptID. It
+// must be called with listLock held, read-only is enough.
+func (room *Room) broadcastLocked(out *outbox, event string, payload any, exceptID string) {
+	for i := range room.peerConnections {
+		if room.peerConnections[i].id != exceptID {
+			out.add(room.peerConnections[i].websocket, event, payload)
+		}
+	}
+}
+
+// outgoingMessage is an event collected under listLock to be sent once the
+// lock is released.
+type outgoingMessage struct {
+	websocket *threadSafeWriter
+	ticket    uint64
+	event     string
+	payload   any
+}
+
+// outbox collects the messages of a listLock critical section, so a slow
+// WebSocket doesn't hold up the room. Every outbox must be sent, since each
+// message holds a place in its connection's delivery order.
+type outbox []outgoingMessage
+
+func (o *outbox) add(ws *threadSafeWriter, event string, payload any) {
+	*o = append(*o, outgoingMessage{websocket: ws, ticket: ws.ticket(), event: event, payload: payload})
+}
+
+// send delivers the collected messages. It must be called without listLock.
+func (o *outbox) send() {
+	for _, message := range *o {
+		if err := message.websocket.replyInTurn(message.ticket, "", message.event, message.payload); err != nil {
+			logging.Warnf("Failed to send %s: %v", message.event, err)
+		}
+	}
+	*o = nil
+}
+
+// announceUpdateLocked tells everyone that the streams published by the
+// participant changed. It must be called with listLock held.
+func (room *Room) announceUpdateLocked(out *outbox, id string) {
+	if peer := room.findPeerLocked(id); peer != nil {
+		info := room.participantInfoLocked(peer)
+		room.broadcastLocked(out, "participant_updated", &info, "")
+	}
+}
+
+// findPeerLocked returns the participant with the given ID or nil. The
+// pointer is only valid while listLock is held.
+func (room *Room) findPeerLocked(id string) *peerConnectionState {
+	for i := range room.peerConnections {
+		if room.peerConnections[i].id == id {
+			return &room.peerConnections[i]
+		}
+	}
+
+	return nil
+}
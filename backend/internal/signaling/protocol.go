@@ -0,0 +1,109 @@
+package signaling
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/Coderovshik/meet/internal/logging"
+)
+
+// ProtocolVersion is the newest signaling protocol version the server speaks.
+//
+// Version 0 is the legacy framing: {"event", "data"} where data is a JSON
+// document encoded as a string. A client opts into version 1 by sending
+// "hello" with the highest version it supports; the server answers with
+// "welcome" carrying the negotiated version. From then on messages carry an
+// ID, an optional reply_to pointing at the message they answer and a typed
+// payload object. Until the handshake completes the server fills both data
+// and payload, so old clients keep working and new ones never have to parse
+// the legacy form.
+const ProtocolVersion = 1
+
+// Codes of "error" events.
+const (
+	errCodeBadRequest         = "bad_request"
+	errCodeUnknownEvent       = "unknown_event"
+	errCodeInvalidPayload     = "invalid_payload"
+	errCodeUnsupportedVersion = "unsupported_version"
+	errCodeNegotiation        = "negotiation_failed"
+	errCodeForbidden          = "forbidden"
+	errCodeNotFound           = "not_found"
+	errCodeInternal           = "internal_error"
+)
+
+type websocketMessage struct {
+	Event   string          `json:"event"`
+	ID      string          `json:"id,omitempty"`
+	ReplyTo string          `json:"reply_to,omitempty"`
+	Data    string          `json:"data,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+var errMissingPayload = errors.New("missing payload")
+
+// decode unmarshals the typed payload or, for legacy clients, the
+// JSON-encoded data string into v.
+func (m *websocketMessage) decode(v any) error {
+	switch {
+	case len(m.Payload) > 0:
+		return json.Unmarshal(m.Payload, v)
+	case m.Data != "":
+		return json.Unmarshal([]byte(m.Data), v)
+	default:
+		return errMissingPayload
+	}
+}
+
+type helloPayload struct {
+	Version int `json:"version"`
+}
+
+type welcomePayload struct {
+	Version       int    `json:"version"`
+	Username      string `json:"username"`
+	DisplayName   string `json:"display_name"`
+	ParticipantID string `json:"participant_id"`
+	Room          string `json:"room"`
+	// DataChannel is the label of the relay data channel.
+	DataChannel string `json:"data_channel"`
+}
+
+type errorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// protocolError is reported to the client as an "error" event instead of
+// closing the connection.
+type protocolError struct {
+	code    string
+	message string
+}
+
+func (e *protocolError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func newProtocolError(code, message string) *protocolError {
+	return &protocolError{code: code, message: message}
+}
+
+// internalError reports a server-side failure, such as an unavailable
+// Redis, without dropping the connection.
+func internalError(err error) *protocolError {
+	logging.Errorf("Signaling request failed: %v", err)
+
+	return newProtocolError(errCodeInternal, "internal error")
+}
+
+// negotiateVersion picks the protocol version for a client that announced
+// support for versions up to clientVersion.
+func negotiateVersion(clientVersion int) (int, error) {
+	if clientVersion < 1 {
+		return 0, newProtocolError(errCodeUnsupportedVersion,
+			"supported versions: 1.."+strconv.Itoa(ProtocolVersion))
+	}
+
+	return min(clientVersion, ProtocolVersion), nil
+}
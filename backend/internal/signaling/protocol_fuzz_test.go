@@ -0,0 +1,54 @@
+package signaling
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// FuzzMessageDecode проверяет, что устаревший формат (data - строка с JSON)
+// и типизированный payload разбираются одинаково
+func FuzzMessageDecode(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add(`{"candidate":"candidate:1 1 UDP 1 192.0.2.1 5000 typ host","sdpMid":"0","sdpMLineIndex":0}`)
+	f.Add(`{"type":"answer","sdp":"v=0"}`)
+	f.Add(`{"version":1}`)
+	f.Add(`"just a string"`)
+	f.Add(`{`)
+	f.Add(string([]byte{0xff, 0xfe})) // Невалидные UTF-8 байты
+
+	f.Fuzz(func(t *testing.T, payload string) {
+		if !json.Valid([]byte(payload)) {
+			return
+		}
+
+		typed := &websocketMessage{Event: "candidate", Payload: json.RawMessage(payload)}
+		legacy := &websocketMessage{Event: "candidate", Data: payload}
+
+		var fromTyped, fromLegacy webrtc.ICECandidateInit
+		typedErr := typed.decode(&fromTyped)
+		legacyErr := legacy.decode(&fromLegacy)
+
+		if (typedErr == nil) != (legacyErr == nil) {
+			t.Fatalf("Разные результаты разбора: %v и %v", typedErr, legacyErr)
+		}
+		if typedErr == nil && !reflect.DeepEqual(fromTyped, fromLegacy) {
+			t.Errorf("Разные кандидаты: %+v и %+v", fromTyped, fromLegacy)
+		}
+
+		// Сообщение должно переживать повторную сериализацию
+		raw, err := json.Marshal(typed)
+		if err != nil {
+			t.Fatalf("Не удалось сериализовать сообщение: %v", err)
+		}
+		decoded := &websocketMessage{}
+		if err := json.Unmarshal(raw, decoded); err != nil {
+			t.Fatalf("Не удалось разобрать сообщение: %v", err)
+		}
+		if decoded.Event != typed.Event {
+			t.Errorf("Событие изменилось: %q", decoded.Event)
+		}
+	})
+}
@@ -0,0 +1,252 @@
+package signaling
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/logging"
+	"github.com/Coderovshik/meet/internal/recording"
+)
+
+// recordingSink names the forwardTrack sink the room recorder writes through.
+const recordingSink = "recording"
+
+var (
+	ErrRoomNotActive   = errors.New("room is not active")
+	ErrRecordingActive = errors.New("room is already being recorded")
+	ErrNotRecording    = errors.New("room is not being recorded")
+)
+
+// recordings starts the recordings of rooms and moves stopped ones into the
+// store, indexing them for the users who may watch them.
+type recordings struct {
+	config recording.Config
+	store  recording.RecordingStore
+	index  *auth.RecordingIndex
+	// archiving counts running uploads so Shutdown can wait for them.
+	archiving sync.WaitGroup
+}
+
+// archive uploads a stopped recording in the background and adds it to the
+// index; on failure its files stay in the spool directory.
+func (r *recordings) archive(recorder *recording.Recorder, manifest *recording.Manifest) {
+	r.archiving.Add(1)
+	go func() {
+		defer r.archiving.Done()
+
+		ctx := context.Background()
+		if err := recording.Archive(ctx, r.store, recorder); err != nil {
+			logging.Errorf("Failed to archive recording %s: %v", recorder.ID(), err)
+
+			return
+		}
+		if err := r.index.AddRecording(ctx, manifest.RoomID, manifest.ID, manifest.StartedAt, manifest.Usernames()); err != nil {
+			logging.Errorf("Failed to index recording %s: %v", recorder.ID(), err)
+		}
+	}()
+}
+
+type recordingPayload struct {
+	ID string `json:"id"`
+	// By is empty when the recording stopped because everyone left.
+	By string `json:"by,omitempty"`
+}
+
+// recordedTrack is a track to be added to a recording together with the
+// participant publishing it.
+type recordedTrack struct {
+	track *forwardTrack
+	owner string
+}
+
+// startRecording starts recording every participant and track of the room,
+// including those that join later, and announces it to everyone. host is
+// stored in the manifest as the account that manages the recording. The
+// recording's directory and files are created outside listLock.
+func (room *Room) startRecording(host, by string) (string, error) {
+	room.listLock.Lock()
+	if room.recorder != nil || room.recordingStarting {
+		room.listLock.Unlock()
+
+		return "", ErrRecordingActive
+	}
+	room.recordingStarting = true
+	room.listLock.Unlock()
+
+	recorder, err := recording.Start(room.recordings.config, room.id, host, by)
+
+	room.listLock.Lock()
+	room.recordingStarting = false
+	if err != nil {
+		room.listLock.Unlock()
+
+		return "", err
+	}
+	room.recorder = recorder
+
+	for i := range room.peerConnections {
+		peer := &room.peerConnections[i]
+		recorder.Join(peer.id, peer.username, peer.displayName)
+	}
+	// Tracks added from now on are recorded by addTrack
+	tracks := make([]recordedTrack, 0, len(room.trackLocals))
+	for id, track := range room.trackLocals {
+		tracks = append(tracks, recordedTrack{track: track, owner: room.trackOwners[id]})
+	}
+
+	var out outbox
+	room.broadcastLocked(&out, "recording_started", &recordingPayload{ID: recorder.ID(), By: by}, "")
+	room.listLock.Unlock()
+	out.send()
+
+	room.recordTracks(recorder, tracks)
+
+	return recorder.ID(), nil
+}
+
+// stopRecording stops the running recording and writes its manifest. Only
+// detaching the tracks happens under listLock; the files are flushed after.
+func (room *Room) stopRecording(by string) (*recording.Manifest, error) {
+	room.listLock.Lock()
+	if room.recorder == nil {
+		room.listLock.Unlock()
+
+		return nil, ErrNotRecording
+	}
+
+	recorder := room.recorder
+	room.recorder = nil
+	for _, track := range room.trackLocals {
+		track.removeSink(recordingSink)
+	}
+
+	var out outbox
+	room.broadcastLocked(&out, "recording_stopped", &recordingPayload{ID: recorder.ID(), By: by}, "")
+	room.listLock.Unlock()
+	out.send()
+
+	manifest, err := recorder.Stop()
+	if err != nil && manifest == nil {
+		return nil, err
+	}
+	if err != nil {
+		logging.Errorf("Failed to finish recording %s: %v", recorder.ID(), err)
+	}
+	room.recordings.archive(recorder, manifest)
+
+	return manifest, nil
+}
+
+// recordTracks creates the files of tracks for a running recording. It must
+// be called without listLock; a file is attached only if its track is still
+// forwarded and the recording still running, otherwise it's closed.
+func (room *Room) recordTracks(recorder *recording.Recorder, tracks []recordedTrack) {
+	for _, t := range tracks {
+		// Tracks in codecs the recorder can't store are skipped
+		writer, err := recorder.AddTrack(t.owner, t.track.ID(), t.track.codec)
+		if errors.Is(err, recording.ErrStopped) {
+			return
+		} else if err != nil {
+			logging.Warnf("Failed to record track %s: %v", t.track.ID(), err)
+
+			continue
+		}
+
+		room.listLock.Lock()
+		attached := room.recorder == recorder && room.trackLocals[t.track.ID()] == t.track
+		if attached {
+			t.track.addSink(recordingSink, writer)
+		}
+		room.listLock.Unlock()
+
+		if !attached {
+			if err := writer.Close(); err != nil {
+				logging.Warnf("Failed to close recording of track %s: %v", t.track.ID(), err)
+			}
+		}
+	}
+}
+
+// stopRecordingTrack closes the file of a track that stopped being forwarded.
+// It must be called without listLock.
+func stopRecordingTrack(track *forwardTrack) {
+	writer, ok := track.removeSink(recordingSink).(*recording.Track)
+	if !ok {
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		logging.Warnf("Failed to close recording of track %s: %v", track.ID(), err)
+	}
+}
+
+// StartRecording starts recording an active room hosted by host on behalf
+// of by.
+func (rr *RoomRegistry) StartRecording(id, host, by string) (string, error) {
+	room, ok := rr.Get(id)
+	if !ok {
+		return "", ErrRoomNotActive
+	}
+
+	return room.startRecording(host, by)
+}
+
+// StopRecording stops recording an active room and returns the manifest.
+func (rr *RoomRegistry) StopRecording(id, by string) (*recording.Manifest, error) {
+	room, ok := rr.Get(id)
+	if !ok {
+		return nil, ErrRoomNotActive
+	}
+
+	return room.stopRecording(by)
+}
+
+func (sc *signalingClient) requireHost() error {
+	if sc.role() != auth.RoleHost {
+		return newProtocolError(errCodeForbidden, "only the host can do this")
+	}
+
+	return nil
+}
+
+func (sc *signalingClient) handleStartRecording(message *websocketMessage) error {
+	if err := sc.requireHost(); err != nil {
+		return err
+	}
+
+	// requireHost made sure the caller is the host.
+	id, err := sc.room.startRecording(sc.username, sc.username)
+	switch {
+	case errors.Is(err, ErrRecordingActive):
+		return newProtocolError(errCodeBadRequest, err.Error())
+	case errors.Is(err, recording.ErrDisabled):
+		return newProtocolError(errCodeForbidden, "recording is disabled on this server")
+	case err != nil:
+		return internalError(err)
+	}
+
+	sc.logAction(sc.identity, "recording_started", fmt.Sprintf("Room: %s, Recording: %s", sc.room.ID(), id))
+
+	return nil
+}
+
+func (sc *signalingClient) handleStopRecording(message *websocketMessage) error {
+	if err := sc.requireHost(); err != nil {
+		return err
+	}
+
+	manifest, err := sc.room.stopRecording(sc.username)
+	switch {
+	case errors.Is(err, ErrNotRecording):
+		return newProtocolError(errCodeBadRequest, err.Error())
+	case err != nil:
+		return internalError(err)
+	}
+
+	sc.logAction(sc.identity, "recording_stopped", fmt.Sprintf("Room: %s, Recording: %s", sc.room.ID(), manifest.ID))
+
+	return nil
+}
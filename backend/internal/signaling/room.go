@@ -0,0 +1,270 @@
+package signaling
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/logging"
+	"github.com/Coderovshik/meet/internal/recording"
+)
+
+// Room is a single call: it owns the peers connected to it and the tracks
+// they publish. Tracks are only forwarded between peers of the same room.
+type Room struct {
+	id string
+
+	listLock        sync.RWMutex
+	peerConnections []peerConnectionState
+	trackLocals     map[string]*forwardTrack
+	// trackOwners maps a track ID to the ID of the participant publishing it.
+	trackOwners map[string]string
+	// lobby holds connections waiting for admission, keyed by participant ID.
+	lobby map[string]*lobbyEntry
+	// speakers tracks the dominant speaker, see speaker.go.
+	speakers *speakerDetector
+	// lastN limits how many recent speakers' video each participant
+	// receives, 0 meaning all; speakerOrder lists participant IDs, most
+	// recent dominant speaker first. See lastn.go.
+	lastN        int
+	speakerOrder []string
+	// speakerChanges wakes up watchSpeakers, which runs from join until done
+	// is closed by the leave that empties the room.
+	speakerChanges chan struct{}
+	done           chan struct{}
+
+	// recordings is shared by all rooms; recorder is set while the room is
+	// being recorded and guarded by listLock, see recording.go.
+	recordings *recordings
+	recorder   *recording.Recorder
+	// recordingStarting is set while startRecording prepares the recorder
+	// outside listLock, so a second start fails right away.
+	recordingStarting bool
+
+	// members counts connections including those waiting in the lobby and
+	// seats only admitted ones; both are guarded by RoomRegistry.lock
+	members int
+	seats   int
+}
+
+func newRoom(id string, recordings *recordings) *Room {
+	return &Room{
+		id:          id,
+		recordings:  recordings,
+		trackLocals: make(map[string]*forwardTrack),
+		trackOwners: make(map[string]string),
+		lobby:       make(map[string]*lobbyEntry),
+		speakers:    newSpeakerDetector(),
+		// Buffered so a pending change is kept while one is being applied
+		speakerChanges: make(chan struct{}, 1),
+		done:           make(chan struct{}),
+	}
+}
+
+// ID returns the room identifier.
+func (room *Room) ID() string {
+	return room.id
+}
+
+var (
+	errRoomFull     = errors.New("room is full")
+	errShuttingDown = errors.New("server is shutting down")
+)
+
+// participants returns usernames of the peers connected to the room.
+func (room *Room) participants() []string {
+	room.listLock.RLock()
+	defer room.listLock.RUnlock()
+
+	usernames := make([]string, 0, len(room.peerConnections))
+	for i := range room.peerConnections {
+		usernames = append(usernames, room.peerConnections[i].username)
+	}
+
+	return usernames
+}
+
+// close sends event to every peer and tears down its PeerConnection and
+// WebSocket.
+func (room *Room) close(event string) {
+	var out outbox
+	room.listLock.Lock()
+	peers := slices.Clone(room.peerConnections)
+	for i := range peers {
+		out.add(peers[i].websocket, event, nil)
+	}
+	waiting := make([]*threadSafeWriter, 0, len(room.lobby))
+	for _, entry := range room.lobby {
+		out.add(entry.websocket, event, nil)
+		waiting = append(waiting, entry.websocket)
+	}
+	room.listLock.Unlock()
+
+	out.send()
+	closePeers(peers)
+	for _, ws := range waiting {
+		ws.Close()
+	}
+}
+
+// RoomRegistry keeps the active rooms keyed by room ID. A room is created on
+// the first join and dropped once its last member leaves.
+type RoomRegistry struct {
+	lock       sync.Mutex
+	rooms      map[string]*Room
+	draining   bool
+	recordings *recordings
+
+	// active counts joins across all rooms so Shutdown can wait for every
+	// connection handler to finish its cleanup.
+	active sync.WaitGroup
+}
+
+// NewRoomRegistry creates a registry whose rooms are recorded according to
+// recordingConfig and whose finished recordings are moved to store and
+// listed in index.
+func NewRoomRegistry(recordingConfig recording.Config, store recording.RecordingStore, index *auth.RecordingIndex) *RoomRegistry {
+	return &RoomRegistry{
+		rooms:      make(map[string]*Room),
+		recordings: &recordings{config: recordingConfig, store: store, index: index},
+	}
+}
+
+// join returns the room with the given ID, creating it if needed, and counts
+// the caller as its member until leave is called. It fails with
+// errShuttingDown once Shutdown was called.
+func (rr *RoomRegistry) join(id string) (*Room, error) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	if rr.draining {
+		return nil, errShuttingDown
+	}
+
+	room, ok := rr.rooms[id]
+	if !ok {
+		room = newRoom(id, rr.recordings)
+		rr.rooms[id] = room
+		go room.watchSpeakers()
+	}
+	room.members++
+	rr.active.Add(1)
+
+	return room, nil
+}
+
+// takeSeat counts a member of the room as a participant until releaseSeat is
+// called. Members waiting in the lobby take a seat only once admitted, so they
+// don't fill the room. It fails with errRoomFull once maxParticipants is
+// reached.
+func (rr *RoomRegistry) takeSeat(room *Room, maxParticipants int) error {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	if maxParticipants > 0 && room.seats >= maxParticipants {
+		return errRoomFull
+	}
+	room.seats++
+
+	return nil
+}
+
+func (rr *RoomRegistry) releaseSeat(room *Room) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	room.seats--
+}
+
+// leave releases a membership taken by join. Once the last member left, a
+// running recording is stopped and its manifest returned.
+func (rr *RoomRegistry) leave(room *Room) *recording.Manifest {
+	defer rr.active.Done()
+
+	rr.lock.Lock()
+	room.members--
+	empty := room.members <= 0
+	if empty && rr.rooms[room.id] == room {
+		delete(rr.rooms, room.id)
+	}
+	rr.lock.Unlock()
+
+	if !empty {
+		return nil
+	}
+	close(room.done)
+
+	manifest, err := room.stopRecording("")
+	if err != nil {
+		if !errors.Is(err, ErrNotRecording) {
+			logging.Errorf("Failed to stop recording of room %s: %v", room.id, err)
+		}
+
+		return nil
+	}
+
+	return manifest
+}
+
+// Get returns the active room with the given ID.
+func (rr *RoomRegistry) Get(id string) (*Room, bool) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	room, ok := rr.rooms[id]
+
+	return room, ok
+}
+
+// Participants returns usernames of everyone currently connected to the room.
+func (rr *RoomRegistry) Participants(id string) []string {
+	room, ok := rr.Get(id)
+	if !ok {
+		return []string{}
+	}
+
+	return room.participants()
+}
+
+// CloseRoom disconnects all participants of the room.
+func (rr *RoomRegistry) CloseRoom(id string) {
+	room, ok := rr.Get(id)
+	if !ok {
+		return
+	}
+
+	room.close("room_closed")
+}
+
+// Shutdown stops accepting new joins, sends "server_shutdown" to every peer,
+// closes their connections and waits until all connection handlers have
+// returned and stopped recordings are archived, or ctx is done.
+func (rr *RoomRegistry) Shutdown(ctx context.Context) error {
+	rr.lock.Lock()
+	rr.draining = true
+	rooms := make([]*Room, 0, len(rr.rooms))
+	for _, room := range rr.rooms {
+		rooms = append(rooms, room)
+	}
+	rr.lock.Unlock()
+
+	for _, room := range rooms {
+		room.close("server_shutdown")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		rr.active.Wait()
+		rr.recordings.archiving.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,62 @@
+package signaling
+
+import (
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/intervalpli"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// nackBufferSize is how many forwarded packets per stream are kept for
+	// retransmission; it must be a power of two.
+	nackBufferSize = 2048
+	// periodicKeyFrameInterval is how often publishers are asked for a key
+	// frame, so subscribers recover from losses NACK couldn't repair.
+	periodicKeyFrameInterval = 3 * time.Second
+)
+
+// configureInterceptors registers the RTCP handling of a connection: NACKs
+// are generated for published streams and answered for forwarded ones,
+// sender and receiver reports are exchanged, publishers get transport-wide
+// CC feedback and periodic PLIs. Subscribers may send REMB for the video
+// they receive, see subscriberBandwidth.
+func configureInterceptors(mediaEngine *webrtc.MediaEngine, registry *interceptor.Registry) error {
+	responder, err := nack.NewResponderInterceptor(nack.ResponderSize(nackBufferSize))
+	if err != nil {
+		return err
+	}
+
+	generator, err := nack.NewGeneratorInterceptor()
+	if err != nil {
+		return err
+	}
+
+	mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBNACK}, webrtc.RTPCodecTypeVideo)
+	mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBNACK, Parameter: "pli"}, webrtc.RTPCodecTypeVideo)
+	mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBGoogREMB}, webrtc.RTPCodecTypeVideo)
+	registry.Add(responder)
+	registry.Add(generator)
+
+	if err = webrtc.ConfigureRTCPReports(registry); err != nil {
+		return err
+	}
+
+	if err = webrtc.ConfigureSimulcastExtensionHeaders(mediaEngine); err != nil {
+		return err
+	}
+
+	if err = webrtc.ConfigureTWCCSender(mediaEngine, registry); err != nil {
+		return err
+	}
+
+	pli, err := intervalpli.NewReceiverInterceptor(intervalpli.GeneratorInterval(periodicKeyFrameInterval))
+	if err != nil {
+		return err
+	}
+	registry.Add(pli)
+
+	return nil
+}
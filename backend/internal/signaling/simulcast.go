@@ -0,0 +1,338 @@
+package signaling
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+)
+
+type setLayerPayload struct {
+	TrackID string `json:"track_id"`
+	// RID selects a simulcast layer; empty restores automatic selection.
+	RID string `json:"rid"`
+}
+
+// selectLayerLocked updates the layer a subscriber should receive and asks
+// the publisher for a key frame to switch on. It must be called with f.mu held.
+func (f *forwardTrack) selectLayerLocked(binding *trackBinding) {
+	target := f.pickLayerLocked(binding)
+	suspended := f.suspendLocked(binding)
+	if target == binding.target && suspended == binding.suspended {
+		return
+	}
+
+	binding.target = target
+	binding.suspended = suspended
+	if suspended {
+		binding.active = false
+
+		return
+	}
+	if binding.paused {
+		return
+	}
+	if binding.active && binding.current == target {
+		return
+	}
+
+	if layer, ok := f.layers[target]; ok {
+		f.requestKeyFrameLocked(layer)
+	}
+}
+
+// suspendLocked decides whether a video subscriber is paused because its
+// estimate can't carry the lowest layer. Resuming needs the full bitrate of
+// that layer, so the subscriber doesn't flap around the threshold.
+func (f *forwardTrack) suspendLocked(binding *trackBinding) bool {
+	if f.kind != webrtc.RTPCodecTypeVideo || binding.estimate == 0 {
+		return false
+	}
+
+	var lowest uint64
+	for _, layer := range f.layers {
+		if layer.bitrate > 0 && (lowest == 0 || layer.bitrate < lowest) {
+			lowest = layer.bitrate
+		}
+	}
+	if lowest == 0 {
+		return false
+	}
+
+	if binding.suspended {
+		return binding.estimate < lowest
+	}
+
+	return binding.estimate < lowest/2
+}
+
+func (f *forwardTrack) pickLayerLocked(binding *trackBinding) string {
+	if !f.simulcast {
+		return ""
+	}
+
+	if _, ok := f.layers[binding.preferred]; ok && binding.preferred != "" {
+		return binding.preferred
+	}
+
+	now := time.Now()
+	layers := make([]*trackLayer, 0, len(f.layers))
+	for _, layer := range f.layers {
+		if !layer.lastPacket.IsZero() && now.Sub(layer.lastPacket) < layerTimeout {
+			layers = append(layers, layer)
+		}
+	}
+	if len(layers) == 0 {
+		return binding.target
+	}
+
+	slices.SortFunc(layers, func(a, b *trackLayer) int {
+		switch {
+		case a.bitrate > b.bitrate:
+			return -1
+		case a.bitrate < b.bitrate:
+			return 1
+		default:
+			return strings.Compare(a.rid, b.rid)
+		}
+	})
+
+	if binding.estimate == 0 {
+		return layers[0].rid
+	}
+
+	current := f.layers[binding.target]
+	for _, layer := range layers {
+		limit := binding.estimate
+		if current != nil && layer.bitrate > current.bitrate {
+			// Going up needs headroom so a noisy estimate doesn't make the
+			// subscriber flap between layers
+			limit = limit * 4 / 5
+		}
+
+		if layer.bitrate <= limit {
+			return layer.rid
+		}
+	}
+
+	return layers[len(layers)-1].rid
+}
+
+// setEstimate updates the bandwidth available to a subscriber for this track.
+func (f *forwardTrack) setEstimate(ssrc webrtc.SSRC, bitrate uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	binding := f.bindingLocked(ssrc)
+	binding.estimate = bitrate
+	f.selectLayerLocked(binding)
+}
+
+// setPreferredLayer pins a subscriber to a layer, or restores automatic
+// selection when rid is empty.
+func (f *forwardTrack) setPreferredLayer(ssrc webrtc.SSRC, rid string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.layers[rid]; rid != "" && (!ok || !f.simulcast) {
+		return errLayerNotFound
+	}
+
+	binding := f.bindingLocked(ssrc)
+	binding.preferred = rid
+	f.selectLayerLocked(binding)
+
+	return nil
+}
+
+// setReceiverReport records the loss and jitter a subscriber reports.
+func (f *forwardTrack) setReceiverReport(ssrc webrtc.SSRC, report rtcp.ReceptionReport) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	binding := f.bindingLocked(ssrc)
+	binding.fractionLost = report.FractionLost
+	binding.jitter = report.Jitter
+}
+
+func (f *forwardTrack) nackReceived(ssrc webrtc.SSRC) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.bindingLocked(ssrc).nacks++
+}
+
+// readSenderRTCP consumes the RTCP a subscriber sends for one forwarded
+// track. Reading drives the sender's interceptors, including the congestion
+// controller and the NACK responder; it stops when the sender is stopped.
+func readSenderRTCP(bandwidth *subscriberBandwidth, sender *webrtc.RTPSender, track *forwardTrack) {
+	encodings := sender.GetParameters().Encodings
+	if len(encodings) == 0 {
+		return
+	}
+	ssrc := encodings[0].SSRC
+
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+
+		for _, packet := range packets {
+			switch packet := packet.(type) {
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				bandwidth.setREMB(uint64(packet.Bitrate))
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				track.keyFrameRequested(ssrc)
+			case *rtcp.TransportLayerNack:
+				// The NACK responder retransmits; only count it for stats
+				track.nackReceived(ssrc)
+			case *rtcp.ReceiverReport:
+				for _, report := range packet.Reports {
+					if report.SSRC == uint32(ssrc) {
+						track.setReceiverReport(ssrc, report)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (sc *signalingClient) handleSetLayer(message *websocketMessage) error {
+	payload := setLayerPayload{}
+	if err := message.decode(&payload); err != nil {
+		return newProtocolError(errCodeInvalidPayload, err.Error())
+	}
+	if payload.TrackID == "" {
+		return newProtocolError(errCodeInvalidPayload, "track_id is required")
+	}
+
+	for _, sender := range sc.peerConnection.GetSenders() {
+		track, ok := sender.Track().(*forwardTrack)
+		if !ok || track.ID() != payload.TrackID {
+			continue
+		}
+
+		encodings := sender.GetParameters().Encodings
+		if len(encodings) == 0 {
+			continue
+		}
+
+		if err := track.setPreferredLayer(encodings[0].SSRC, payload.RID); err != nil {
+			return newProtocolError(errCodeNotFound, "no layer "+payload.RID+" in track "+payload.TrackID)
+		}
+
+		return nil
+	}
+
+	return newProtocolError(errCodeNotFound, "track not found")
+}
+
+// canDetectKeyFrames reports whether isKeyFrame understands the codec.
+func canDetectKeyFrames(mimeType string) bool {
+	for _, known := range []string{webrtc.MimeTypeVP8, webrtc.MimeTypeVP9, webrtc.MimeTypeH264} {
+		if strings.EqualFold(mimeType, known) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isKeyFrame reports whether an RTP payload starts a key frame, so a
+// subscriber can switch layers without a decoding gap.
+func isKeyFrame(mimeType string, payload []byte) bool {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return isVP8KeyFrame(payload)
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		return isVP9KeyFrame(payload)
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return isH264KeyFrame(payload)
+	default:
+		return false
+	}
+}
+
+// isVP8KeyFrame parses the payload descriptor of RFC 7741 and checks the P
+// bit of the first partition of a frame.
+func isVP8KeyFrame(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	start, partition := payload[0]&0x10 != 0, payload[0]&0x07
+	offset := 1
+	if payload[0]&0x80 != 0 {
+		if len(payload) < 2 {
+			return false
+		}
+		extension := payload[1]
+		offset++
+		if extension&0x80 != 0 { // PictureID
+			if len(payload) <= offset {
+				return false
+			}
+			if payload[offset]&0x80 != 0 {
+				offset++
+			}
+			offset++
+		}
+		if extension&0x40 != 0 { // TL0PICIDX
+			offset++
+		}
+		if extension&0x30 != 0 { // TID/KEYIDX
+			offset++
+		}
+	}
+
+	if !start || partition != 0 || len(payload) <= offset {
+		return false
+	}
+
+	return payload[offset]&0x01 == 0
+}
+
+// isVP9KeyFrame checks the descriptor of draft-ietf-payload-vp9: the start
+// of a frame that isn't inter-picture predicted.
+func isVP9KeyFrame(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	return payload[0]&0x40 == 0 && payload[0]&0x08 != 0
+}
+
+// isH264KeyFrame looks for an IDR slice or SPS in single NAL unit, STAP-A
+// and FU-A packets of RFC 6184.
+func isH264KeyFrame(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	const (
+		nalIDR   = 5
+		nalSPS   = 7
+		nalSTAPA = 24
+		nalFUA   = 28
+	)
+
+	switch nalType := payload[0] & 0x1F; nalType {
+	case nalIDR, nalSPS:
+		return true
+	case nalSTAPA:
+		for offset := 1; offset+2 < len(payload); {
+			size := int(payload[offset])<<8 | int(payload[offset+1])
+			if t := payload[offset+2] & 0x1F; t == nalIDR || t == nalSPS {
+				return true
+			}
+			offset += 2 + size
+		}
+	case nalFUA:
+		return len(payload) > 1 && payload[1]&0x80 != 0 && payload[1]&0x1F == nalIDR
+	}
+
+	return false
+}
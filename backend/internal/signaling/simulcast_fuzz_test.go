@@ -0,0 +1,36 @@
+package signaling
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// FuzzKeyFrame проверяет, что разбор дескрипторов VP8, VP9 и H264 не выходит
+// за границы произвольного payload
+func FuzzKeyFrame(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add([]byte{0x10, 0x00, 0x9d, 0x01, 0x2a})       // VP8, ключевой кадр
+	f.Add([]byte{0x90, 0xe0, 0x80, 0x01, 0x00, 0x01}) // VP8 с расширенным дескриптором
+	f.Add([]byte{0x88, 0x00})                         // VP9, начало ключевого кадра
+	f.Add([]byte{0x65, 0x88})                         // H264 IDR
+	f.Add([]byte{0x18, 0x00, 0x02, 0x67, 0x42})       // H264 STAP-A с SPS
+	f.Add([]byte{0x7c, 0x85})                         // H264 FU-A, начало IDR
+	f.Add([]byte{0x18, 0xff, 0xff})                   // STAP-A с неверной длиной
+	f.Add([]byte{})
+
+	mimeTypes := []string{webrtc.MimeTypeVP8, webrtc.MimeTypeVP9, webrtc.MimeTypeH264, webrtc.MimeTypeOpus}
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		for _, mimeType := range mimeTypes {
+			keyFrame := isKeyFrame(mimeType, payload)
+
+			if len(payload) == 0 && keyFrame {
+				t.Errorf("%s: пустой payload распознан как ключевой кадр", mimeType)
+			}
+			if mimeType == webrtc.MimeTypeOpus && keyFrame {
+				t.Errorf("аудио не содержит ключевых кадров")
+			}
+		}
+	})
+}
@@ -0,0 +1,197 @@
+package signaling
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// audioLevelURI is the RFC 6464 header extension carrying the level of each
+// audio packet, which the publisher measures so the SFU doesn't have to
+// decode Opus.
+const audioLevelURI = "urn:ietf:params:rtp-hdrext:ssrc-audio-level"
+
+const (
+	// speakerInterval is how often the dominant speaker is re-evaluated.
+	speakerInterval = 300 * time.Millisecond
+	// silenceLevel is the level in -dBov from which a packet counts as silence;
+	// louder packets score silenceLevel minus their level.
+	silenceLevel = 70
+	// speakerSmoothing is the weight of the latest interval in the smoothed score.
+	speakerSmoothing = 0.4
+	// minSpeakerScore is the smoothed score needed to become the dominant speaker.
+	minSpeakerScore = 5
+	// speakerMargin and speakerSwitchIntervals keep the dominant speaker
+	// until someone else is clearly louder for about a second, so short
+	// interjections and noise don't make the UI jump around.
+	speakerMargin          = 1.25
+	speakerSwitchIntervals = 3
+)
+
+type activeSpeakerPayload struct {
+	// ID is the participant ID of the dominant speaker.
+	ID string `json:"id"`
+}
+
+// speakerDetector picks the dominant speaker of a room from the audio
+// levels of the packets its participants publish.
+type speakerDetector struct {
+	mu       sync.Mutex
+	speakers map[string]*speakerScore
+	dominant string
+	// challenger has been louder than the dominant speaker for
+	// challengerIntervals evaluations in a row.
+	challenger          string
+	challengerIntervals int
+	lastEvaluation      time.Time
+}
+
+type speakerScore struct {
+	sum      float64
+	packets  int
+	smoothed float64
+}
+
+func newSpeakerDetector() *speakerDetector {
+	return &speakerDetector{speakers: map[string]*speakerScore{}}
+}
+
+// current returns the dominant speaker, or "" before anyone spoke.
+func (d *speakerDetector) current() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.dominant
+}
+
+// observe accounts the level of one audio packet and returns the new
+// dominant speaker when it changed.
+func (d *speakerDetector) observe(participantID string, level uint8, now time.Time) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	speaker, ok := d.speakers[participantID]
+	if !ok {
+		speaker = &speakerScore{}
+		d.speakers[participantID] = speaker
+	}
+	speaker.sum += float64(max(silenceLevel-int(level), 0))
+	speaker.packets++
+
+	if d.lastEvaluation.IsZero() {
+		d.lastEvaluation = now
+	}
+	if now.Sub(d.lastEvaluation) < speakerInterval {
+		return "", false
+	}
+	d.lastEvaluation = now
+
+	return d.evaluateLocked()
+}
+
+// evaluateLocked folds the packets of the last interval into the smoothed
+// scores; participants who sent nothing, e.g. because they're muted, score
+// silence. It must be called with d.mu held.
+func (d *speakerDetector) evaluateLocked() (string, bool) {
+	var loudest string
+	for id, speaker := range d.speakers {
+		mean := 0.0
+		if speaker.packets > 0 {
+			mean = speaker.sum / float64(speaker.packets)
+		}
+		speaker.smoothed += (mean - speaker.smoothed) * speakerSmoothing
+		speaker.sum, speaker.packets = 0, 0
+
+		if best, ok := d.speakers[loudest]; !ok || speaker.smoothed > best.smoothed ||
+			(speaker.smoothed == best.smoothed && id < loudest) {
+			loudest = id
+		}
+	}
+
+	candidate, ok := d.speakers[loudest]
+	if !ok || candidate.smoothed < minSpeakerScore || loudest == d.dominant {
+		d.challenger, d.challengerIntervals = "", 0
+
+		return "", false
+	}
+
+	if dominant, ok := d.speakers[d.dominant]; ok {
+		if candidate.smoothed <= dominant.smoothed*speakerMargin {
+			d.challenger, d.challengerIntervals = "", 0
+
+			return "", false
+		}
+
+		if d.challenger != loudest {
+			d.challenger, d.challengerIntervals = loudest, 0
+		}
+		d.challengerIntervals++
+		if d.challengerIntervals < speakerSwitchIntervals {
+			return "", false
+		}
+	}
+
+	d.dominant = loudest
+	d.challenger, d.challengerIntervals = "", 0
+
+	return loudest, true
+}
+
+// remove forgets a participant who left. If it was the dominant speaker, the
+// loudest remaining participant takes over right away.
+func (d *speakerDetector) remove(participantID string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.speakers, participantID)
+	if d.challenger == participantID {
+		d.challenger, d.challengerIntervals = "", 0
+	}
+	if d.dominant != participantID {
+		return "", false
+	}
+
+	d.dominant = ""
+	var loudest string
+	for id, speaker := range d.speakers {
+		if best, ok := d.speakers[loudest]; speaker.smoothed >= minSpeakerScore &&
+			(!ok || speaker.smoothed > best.smoothed || (speaker.smoothed == best.smoothed && id < loudest)) {
+			loudest = id
+		}
+	}
+	d.dominant = loudest
+
+	return loudest, true
+}
+
+// audioLevelExtensionID returns the ID negotiated for the audio level
+// extension on a receiver, or 0 if the publisher doesn't send it.
+func audioLevelExtensionID(receiver *webrtc.RTPReceiver) uint8 {
+	for _, extension := range receiver.GetParameters().HeaderExtensions {
+		if extension.URI == audioLevelURI {
+			return uint8(extension.ID)
+		}
+	}
+
+	return 0
+}
+
+// observeAudioLevel reads the audio level of a published packet and
+// hands a change of the dominant speaker to watchSpeakers.
+func (room *Room) observeAudioLevel(participantID string, extensionID uint8, packet *rtp.Packet) {
+	payload := packet.GetExtension(extensionID)
+	if payload == nil {
+		return
+	}
+
+	level := rtp.AudioLevelExtension{}
+	if err := level.Unmarshal(payload); err != nil {
+		return
+	}
+
+	if _, changed := room.speakers.observe(participantID, level.Level, time.Now()); changed {
+		room.notifySpeakerChanged()
+	}
+}
@@ -0,0 +1,68 @@
+package signaling
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// FuzzSpeakerDetector проверяет выбор основного докладчика на произвольной
+// последовательности пакетов и уходов участников. Каждые три байта входа -
+// участник (значения от 4 и выше означают уход), уровень звука и пауза в мс
+func FuzzSpeakerDetector(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add([]byte{0, 20, 20, 1, 127, 20, 0, 20, 20, 1, 127, 20})
+	f.Add([]byte{0, 30, 200, 1, 10, 200, 1, 10, 200, 1, 10, 200, 1, 10, 200})
+	f.Add([]byte{0, 10, 255, 4, 0, 0, 1, 127, 255})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, events []byte) {
+		detector := newSpeakerDetector()
+		present := map[string]bool{}
+		now := time.Unix(0, 0)
+		dominant := ""
+
+		for i := 0; i+2 < len(events); i += 3 {
+			id := strconv.Itoa(int(events[i] % 4))
+			now = now.Add(time.Duration(events[i+2]) * time.Millisecond)
+
+			var speaker string
+			var changed bool
+			if events[i] >= 4 {
+				delete(present, id)
+				speaker, changed = detector.remove(id)
+				if changed != (dominant == id) {
+					t.Fatalf("Уход %s: changed = %v при докладчике %q", id, changed, dominant)
+				}
+			} else {
+				present[id] = true
+				speaker, changed = detector.observe(id, events[i+1]&0x7f, now)
+				if changed && speaker == dominant {
+					t.Fatalf("Сообщено о смене докладчика на прежнего %q", speaker)
+				}
+			}
+
+			if changed {
+				dominant = speaker
+			}
+			if current := detector.current(); current != dominant {
+				t.Fatalf("current() = %q, последнее событие - %q", current, dominant)
+			}
+			if dominant != "" && !present[dominant] {
+				t.Fatalf("Основной докладчик %q не находится в комнате", dominant)
+			}
+		}
+
+		// Громкий участник становится докладчиком, когда остальные молчат
+		for range 20 {
+			now = now.Add(100 * time.Millisecond)
+			detector.observe("loud", 10, now)
+			for id := range present {
+				detector.observe(id, 127, now)
+			}
+		}
+		if current := detector.current(); current != "loud" {
+			t.Fatalf("Основной докладчик %q, ожидался loud", current)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package signaling
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ParticipantStats describes the media a participant receives, to diagnose
+// bad calls.
+type ParticipantStats struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	// EstimatedBitrate is the estimated downlink in bits per second and
+	// EstimateSource is "twcc" or "remb", empty while nothing is known.
+	EstimatedBitrate uint64 `json:"estimated_bitrate"`
+	EstimateSource   string `json:"estimate_source"`
+	// Congestion is the internal state of the congestion controller.
+	Congestion map[string]any        `json:"congestion"`
+	Tracks     []ForwardedTrackStats `json:"tracks"`
+}
+
+// ForwardedTrackStats describes one track forwarded to a participant.
+type ForwardedTrackStats struct {
+	TrackID     string `json:"track_id"`
+	Kind        string `json:"kind"`
+	PublisherID string `json:"publisher_id"`
+	// Layer is the simulcast layer being forwarded and TargetLayer the one
+	// selected for the participant.
+	Layer        string `json:"layer"`
+	TargetLayer  string `json:"target_layer"`
+	LayerBitrate uint64 `json:"layer_bitrate"`
+	// Share is the part of the estimate given to this track.
+	Share      uint64 `json:"share"`
+	Forwarding bool   `json:"forwarding"`
+	Suspended  bool   `json:"suspended"`
+	// Paused is set while the publisher is outside the participant's last N.
+	Paused bool `json:"paused"`
+	// PacketLoss (percent) and Jitter (RTP timestamp units) come from the
+	// participant's last receiver report.
+	PacketLoss float64 `json:"packet_loss"`
+	Jitter     uint32  `json:"jitter"`
+	// NACKs and KeyFrameRequests count RTCP feedback from the participant.
+	NACKs            uint64 `json:"nacks"`
+	KeyFrameRequests uint64 `json:"key_frame_requests"`
+}
+
+// Stats returns the forwarding state of every participant of the room.
+func (rr *RoomRegistry) Stats(id string) []ParticipantStats {
+	room, ok := rr.Get(id)
+	if !ok {
+		return []ParticipantStats{}
+	}
+
+	return room.stats()
+}
+
+func (room *Room) stats() []ParticipantStats {
+	room.listLock.RLock()
+	defer room.listLock.RUnlock()
+
+	stats := make([]ParticipantStats, 0, len(room.peerConnections))
+	for i := range room.peerConnections {
+		peer := &room.peerConnections[i]
+		participant := ParticipantStats{
+			ID:       peer.id,
+			Username: peer.username,
+			Tracks:   []ForwardedTrackStats{},
+		}
+
+		if peer.bandwidth != nil {
+			participant.EstimatedBitrate, participant.EstimateSource = peer.bandwidth.estimate()
+			participant.Congestion = peer.bandwidth.estimator.GetStats()
+		}
+
+		for _, sender := range peer.peerConnection.GetSenders() {
+			track, ok := sender.Track().(*forwardTrack)
+			if !ok {
+				continue
+			}
+
+			encodings := sender.GetParameters().Encodings
+			if len(encodings) == 0 {
+				continue
+			}
+
+			trackStats := track.stats(encodings[0].SSRC)
+			trackStats.PublisherID = room.trackOwners[track.ID()]
+			participant.Tracks = append(participant.Tracks, trackStats)
+		}
+
+		slices.SortFunc(participant.Tracks, func(a, b ForwardedTrackStats) int {
+			return strings.Compare(a.TrackID, b.TrackID)
+		})
+		stats = append(stats, participant)
+	}
+
+	return stats
+}
+
+func (f *forwardTrack) stats(ssrc webrtc.SSRC) ForwardedTrackStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := ForwardedTrackStats{
+		TrackID: f.id,
+		Kind:    f.kind.String(),
+	}
+
+	binding, ok := f.bindings[ssrc]
+	if !ok {
+		return stats
+	}
+
+	stats.TargetLayer = binding.target
+	stats.Share = binding.estimate
+	stats.Forwarding = binding.active
+	stats.Suspended = binding.suspended
+	stats.Paused = binding.paused
+	stats.PacketLoss = float64(binding.fractionLost) * 100 / 256
+	stats.Jitter = binding.jitter
+	stats.NACKs = binding.nacks
+	stats.KeyFrameRequests = binding.keyFrameRequests
+	if binding.active {
+		stats.Layer = binding.current
+		if layer, ok := f.layers[binding.current]; ok {
+			stats.LayerBitrate = layer.bitrate
+		}
+	}
+
+	return stats
+}
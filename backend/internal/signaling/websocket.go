@@ -1,87 +1,274 @@
 package signaling
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
-	"sync"
+	"strings"
 
 	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/ice"
+	"github.com/Coderovshik/meet/internal/logging"
+	"github.com/Coderovshik/meet/internal/origin"
 
 	"github.com/gorilla/websocket"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// origin := r.Header.Get("Origin")
-		// return strings.Contains(origin, "amogus.root-hub.ru")
-		return true
-	},
-}
+// authenticate определяет пользователя по токену сессии (заголовок
+// "Authorization: Bearer" или параметр token) либо, если это разрешено
+// настройкой ws_query_password, по паре username/password из строки запроса.
+// Пароль в адресе попадает в журналы прокси и историю браузера, поэтому
+// по умолчанию такой вход отключен
+func authenticate(r *http.Request, userStore *auth.UserStore, sessionStore *auth.SessionStore, allowQueryPassword bool) (who identity, ok bool, err error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	if token != "" {
+		session, err := sessionStore.ValidateSession(r.Context(), token)
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			return identity{}, false, nil
+		} else if err != nil {
+			return identity{}, false, err
+		}
+		return identity{username: session.Username, displayName: session.Username, session: true}, true, nil
+	}
 
-type websocketMessage struct {
-	Event string `json:"event"`
-	Data  string `json:"data"`
+	username := r.URL.Query().Get("username")
+	password := r.URL.Query().Get("password")
+	if !allowQueryPassword || username == "" || password == "" {
+		return identity{}, false, nil
+	}
+
+	valid, err := userStore.ValidateUser(r.Context(), username, password)
+	return identity{username: username, displayName: username}, valid, err
 }
 
-func HandleWebSocket(userStore *auth.UserStore, logStore *auth.LogStore) http.HandlerFunc {
+func HandleWebSocket(rooms *RoomRegistry, userStore *auth.UserStore, sessionStore *auth.SessionStore, roomStore *auth.RoomStore, inviteStore *auth.InviteStore, chatStore *auth.ChatStore, logStore *auth.LogStore, iceServers *ice.Provider, origins *origin.Allowlist, allowQueryPassword bool) http.HandlerFunc {
+	upgrader := websocket.Upgrader{CheckOrigin: origins.Allowed}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		username := r.URL.Query().Get("username")
-		password := r.URL.Query().Get("password")
+		query := r.URL.Query()
+		roomID := query.Get("room")
+		inviteToken := query.Get("invite")
+		hasCredentials := r.Header.Get("Authorization") != "" || query.Get("token") != "" || inviteToken != "" ||
+			(allowQueryPassword && query.Get("username") != "" && query.Get("password") != "")
 
-		if username == "" || password == "" {
+		if !hasCredentials || (roomID == "" && inviteToken == "") {
 			http.Error(w, "Missing credentials or room", http.StatusBadRequest)
 			return
 		}
 
-		valid, err := userStore.ValidateUser(r.Context(), username, password)
+		var who identity
+		if inviteToken != "" {
+			// Гость: приглашение привязано к комнате, имя задается при подключении
+			invite, err := inviteStore.ParseInvite(inviteToken)
+			if err != nil {
+				http.Error(w, "Invalid or expired invite", http.StatusUnauthorized)
+				return
+			}
+			if roomID == "" {
+				roomID = invite.RoomID
+			}
+			if invite.RoomID != roomID {
+				http.Error(w, "Invite is for another room", http.StatusForbidden)
+				return
+			}
+
+			displayName, err := auth.ValidateDisplayName(query.Get("name"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			who = identity{username: auth.NewGuestUsername(), displayName: displayName, invite: invite}
+		} else {
+			user, valid, err := authenticate(r, userStore, sessionStore, allowQueryPassword)
+			if err != nil {
+				http.Error(w, "Internal error", http.StatusInternalServerError)
+				return
+			}
+			if !valid {
+				if user.username != "" {
+					details := fmt.Sprintf("Неудачная попытка подключения к комнате %s. IP: %s, User-Agent: %s",
+						roomID, r.RemoteAddr, r.UserAgent())
+					if err := logStore.AddLog(r.Context(), user.username, "room_connection_failed", details); err != nil {
+						logging.Errorf("Ошибка при логировании неудачной попытки подключения к комнате: %v", err)
+					}
+				}
+
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			who = user
+		}
+		username := who.username
+
+		// Защита от cross-site WebSocket hijacking: проверяем Origin до
+		// подключения к комнате, чтобы записать отказ в журнал пользователя
+		if !origins.Allowed(r) {
+			details := fmt.Sprintf("Origin: %s, Room: %s, IP: %s, User-Agent: %s",
+				r.Header.Get("Origin"), roomID, r.RemoteAddr, r.UserAgent())
+			if err := who.addLog(r.Context(), logStore, "origin_rejected", details); err != nil {
+				logging.Errorf("Ошибка при логировании подключения с неразрешенного источника: %v", err)
+			}
+
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		roomInfo, err := roomStore.GetOpenRoom(r.Context(), roomID)
+		switch {
+		case errors.Is(err, auth.ErrRoomNotFound):
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		case errors.Is(err, auth.ErrRoomClosed):
+			http.Error(w, "Room is closed", http.StatusGone)
+			return
+		case err != nil:
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		role := auth.RoleParticipant
+		if who.guest() {
+			role = who.invite.Role
+		} else if role, err = roomStore.GetRole(r.Context(), roomInfo, username); err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		banned, err := roomStore.IsBanned(r.Context(), roomID, username)
+		if err == nil && !banned && who.guest() {
+			banned, err = roomStore.IsInviteBanned(r.Context(), roomID, who.invite.ID)
+		}
 		if err != nil {
 			http.Error(w, "Internal error", http.StatusInternalServerError)
 			return
 		}
-		if !valid {
-			details := fmt.Sprintf("Неудачная попытка подключения к комнате. IP: %s, User-Agent: %s",
-				r.RemoteAddr, r.UserAgent())
-			if err := logStore.AddLog(r.Context(), username, "room_connection_failed", details); err != nil {
-				log.Printf("Ошибка при логировании неудачной попытки подключения к комнате: %v", err)
+		rejectReason := ""
+		switch {
+		case banned:
+			rejectReason = "banned"
+		case roomInfo.Locked && !auth.CanModerate(role):
+			rejectReason = "locked"
+		}
+		if rejectReason != "" {
+			details := fmt.Sprintf("Room: %s, Reason: %s, IP: %s, User-Agent: %s", roomID, rejectReason, r.RemoteAddr, r.UserAgent())
+			if err := who.addLog(r.Context(), logStore, "room_connection_rejected", details); err != nil {
+				logging.Errorf("Ошибка при логировании отклоненного подключения к комнате: %v", err)
+			}
+
+			http.Error(w, "Room access denied: "+rejectReason, http.StatusForbidden)
+			return
+		}
+
+		// Использование приглашения засчитывается только после всех проверок
+		if who.guest() {
+			if _, err := inviteStore.RedeemInvite(r.Context(), inviteToken); errors.Is(err, auth.ErrInviteExhausted) {
+				http.Error(w, "Invite has no uses left", http.StatusForbidden)
+				return
+			} else if err != nil {
+				http.Error(w, "Internal error", http.StatusInternalServerError)
+				return
 			}
+		}
 
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		room, err := rooms.join(roomID)
+		if err != nil {
+			http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
 			return
 		}
+		defer func() {
+			// Запись останавливается, когда комнату покидает последний участник
+			manifest := rooms.leave(room)
+			if manifest == nil {
+				return
+			}
+			details := fmt.Sprintf("Room: %s, Recording: %s", roomID, manifest.ID)
+			if err := logStore.AddLog(context.WithoutCancel(r.Context()), manifest.StartedBy, "recording_stopped", details); err != nil {
+				logging.Errorf("Ошибка при логировании остановки записи: %v", err)
+			}
+		}()
+
+		// Ожидающие в зале не занимают мест: место занимается после допуска
+		inLobby := roomInfo.Lobby && !auth.CanModerate(role)
+		if !inLobby {
+			if err := rooms.takeSeat(room, roomInfo.MaxParticipants); err != nil {
+				http.Error(w, "Room is full", http.StatusForbidden)
+				return
+			}
+			defer rooms.releaseSeat(room)
+		}
 
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			http.Error(w, "Failed to upgrade connection", http.StatusInternalServerError)
 			return
 		}
-		c := &threadSafeWriter{conn, sync.Mutex{}}
+		c := newThreadSafeWriter(conn)
 		defer c.Close()
 
-		details := fmt.Sprintf("IP: %s, User-Agent: %s", r.RemoteAddr, r.UserAgent())
-		if err := logStore.AddLog(r.Context(), username, "room_connection", details); err != nil {
-			log.Printf("Ошибка при логировании подключения к комнате: %v", err)
+		details := fmt.Sprintf("Room: %s, IP: %s, User-Agent: %s", roomID, r.RemoteAddr, r.UserAgent())
+		if err := who.addLog(r.Context(), logStore, "room_connection", details); err != nil {
+			logging.Errorf("Ошибка при логировании подключения к комнате: %v", err)
 		}
 
-		peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{
-			ICEServers: []webrtc.ICEServer{
-				{
-					URLs: []string{"stun:stun.l.google.com:19302"},
-				},
-			},
+		done := make(chan struct{})
+		defer close(done)
+		incoming := readMessages(c, done)
+
+		participantID := newParticipantID()
+		client := &signalingClient{
+			ctx:           r.Context(),
+			room:          room,
+			identity:      who,
+			participantID: participantID,
+			roomStore:     roomStore,
+			chatStore:     chatStore,
+			logStore:      logStore,
+			websocket:     c,
+		}
+
+		// В комнате с залом ожидания медиа подключается только после решения ведущего
+		if inLobby {
+			if !client.waitInLobby(incoming) {
+				return
+			}
+			if err := rooms.takeSeat(room, roomInfo.MaxParticipants); err != nil {
+				details := fmt.Sprintf("Room: %s, Reason: full, IP: %s, User-Agent: %s", roomID, r.RemoteAddr, r.UserAgent())
+				if err := who.addLog(r.Context(), logStore, "room_connection_rejected", details); err != nil {
+					logging.Errorf("Ошибка при логировании отклоненного подключения к комнате: %v", err)
+				}
+				if err := c.closeWithReason(websocket.ClosePolicyViolation, "room is full"); err != nil {
+					logging.Debugf("Failed to send close frame: %v", err)
+				}
+
+				return
+			}
+			defer rooms.releaseSeat(room)
+		}
+
+		servers := iceServers.PublicServers()
+		if owner, ok := who.credentialsOwner(); ok {
+			servers, _ = iceServers.Servers(owner)
+		}
+		peerConnection, bandwidth, err := newPeerConnection(webrtc.Configuration{
+			ICEServers: servers,
 		})
 		if err != nil {
-			log.Printf("Failed to creates a PeerConnection: %v", err)
+			logging.Errorf("Failed to creates a PeerConnection: %v", err)
 
 			return
 		}
 		defer func() {
-			disconnectDetails := fmt.Sprintf("IP: %s", r.RemoteAddr)
-			if closeErr := logStore.AddLog(r.Context(), username, "room_disconnection", disconnectDetails); closeErr != nil {
-				log.Printf("Ошибка при логировании отключения от комнаты: %v", closeErr)
+			// Запись должна попасть в журнал и во время остановки сервера
+			disconnectDetails := fmt.Sprintf("Room: %s, IP: %s", roomID, r.RemoteAddr)
+			if closeErr := who.addLog(context.WithoutCancel(r.Context()), logStore, "room_disconnection", disconnectDetails); closeErr != nil {
+				logging.Errorf("Ошибка при логировании отключения от комнаты: %v", closeErr)
 			}
 			peerConnection.Close()
 		}()
@@ -90,65 +277,86 @@ func HandleWebSocket(userStore *auth.UserStore, logStore *auth.LogStore) http.Ha
 			if _, err := peerConnection.AddTransceiverFromKind(typ, webrtc.RTPTransceiverInit{
 				Direction: webrtc.RTPTransceiverDirectionRecvonly,
 			}); err != nil {
-				log.Printf("Failed to add transceiver: %v", err)
+				logging.Errorf("Failed to add transceiver: %v", err)
 
 				return
 			}
 		}
 
-		listLock.Lock()
-		peerConnections = append(peerConnections, peerConnectionState{peerConnection, c})
-		listLock.Unlock()
+		dataChannel, err := room.openDataChannel(peerConnection, participantID)
+		if err != nil {
+			logging.Errorf("Failed to create data channel: %v", err)
 
-		peerConnection.OnICECandidate(func(i *webrtc.ICECandidate) {
-			if i == nil {
-				return
-			}
+			return
+		}
 
-			candidateString, err := json.Marshal(i.ToJSON())
-			if err != nil {
-				log.Printf("Failed to marshal candidate to json: %v", err)
+		room.setLastN(roomInfo.LastN)
+		media := &mediaState{}
+		media.viewOnly.Store(role == auth.RoleViewer)
+		room.addPeer(peerConnectionState{
+			peerConnection: peerConnection,
+			websocket:      c,
+			username:       username,
+			id:             participantID,
+			media:          media,
+			role:           role,
+			displayName:    who.displayName,
+			invite:         who.invite,
+			dataChannel:    dataChannel,
+			bandwidth:      bandwidth,
+			pins:           map[string]bool{},
+		})
+		defer room.removePeer(participantID)
+		client.sendChatHistory()
 
+		peerConnection.OnICECandidate(func(i *webrtc.ICECandidate) {
+			if i == nil {
 				return
 			}
 
-			log.Printf("Send candidate to client: %s", candidateString)
+			candidate := i.ToJSON()
+			logging.Debugf("Send candidate to client: %s", candidate.Candidate)
 
-			if writeErr := c.WriteJSON(&websocketMessage{
-				Event: "candidate",
-				Data:  string(candidateString),
-			}); writeErr != nil {
-				log.Printf("Failed to write JSON: %v", writeErr)
+			if writeErr := c.send("candidate", candidate); writeErr != nil {
+				logging.Errorf("Failed to write JSON: %v", writeErr)
 			}
 		})
 
 		peerConnection.OnConnectionStateChange(func(p webrtc.PeerConnectionState) {
-			log.Printf("Connection state change: %s", p)
+			logging.Debugf("Connection state change: %s", p)
 
 			switch p {
 			case webrtc.PeerConnectionStateFailed:
 				if err := peerConnection.Close(); err != nil {
-					log.Printf("Failed to close PeerConnection: %v", err)
+					logging.Errorf("Failed to close PeerConnection: %v", err)
 				}
 			case webrtc.PeerConnectionStateClosed:
-				signalPeerConnections()
+				room.signalPeerConnections()
 			default:
 			}
 		})
 
-		peerConnection.OnTrack(func(t *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
-			log.Printf("Got remote track: Kind=%s, ID=%s, PayloadType=%d", t.Kind(), t.ID(), t.PayloadType())
+		peerConnection.OnTrack(func(t *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+			logging.Infof("Got remote track: Kind=%s, ID=%s, RID=%s, PayloadType=%d", t.Kind(), t.ID(), t.RID(), t.PayloadType())
 
 			trackDetails := fmt.Sprintf("Track kind: %s, ID: %s", t.Kind(), t.ID())
-			if err := logStore.AddLog(r.Context(), username, "add_track", trackDetails); err != nil {
-				log.Printf("Ошибка при логировании добавления трека: %v", err)
+			if err := who.addLog(r.Context(), logStore, "add_track", trackDetails); err != nil {
+				logging.Errorf("Ошибка при логировании добавления трека: %v", err)
 			}
 
-			trackLocal := addTrack(t)
-			defer removeTrack(trackLocal)
+			trackLocal := room.addTrack(t, participantID, peerConnection)
+			defer room.removeTrack(trackLocal, t.RID())
+
+			var audioLevelID uint8
+			if t.Kind() == webrtc.RTPCodecTypeAudio {
+				audioLevelID = audioLevelExtensionID(receiver)
+			}
 
 			buf := make([]byte, 1500)
 			rtpPkt := &rtp.Packet{}
+			// Packets dropped while muted are cut out of the sequence so that
+			// subscribers don't treat the pause as loss
+			var dropped uint16
 
 			for {
 				i, _, err := t.Read(buf)
@@ -156,78 +364,70 @@ func HandleWebSocket(userStore *auth.UserStore, logStore *auth.LogStore) http.Ha
 					return
 				}
 
+				if media.paused(t.Kind()) {
+					dropped++
+
+					continue
+				}
+
 				if err = rtpPkt.Unmarshal(buf[:i]); err != nil {
-					log.Printf("Failed to unmarshal incoming RTP packet: %v", err)
+					logging.Errorf("Failed to unmarshal incoming RTP packet: %v", err)
 
 					return
 				}
 
+				rtpPkt.SequenceNumber -= dropped
+				if audioLevelID != 0 {
+					room.observeAudioLevel(participantID, audioLevelID, rtpPkt)
+				}
+				// Extension IDs are negotiated per PeerConnection, so they
+				// can't be forwarded as is
 				rtpPkt.Extension = false
 				rtpPkt.Extensions = nil
 
-				if err = trackLocal.WriteRTP(rtpPkt); err != nil {
-					return
-				}
+				trackLocal.writeRTP(t.RID(), rtpPkt)
 			}
 		})
 
 		peerConnection.OnICEConnectionStateChange(func(is webrtc.ICEConnectionState) {
-			log.Printf("ICE connection state changed: %s", is)
+			logging.Debugf("ICE connection state changed: %s", is)
 		})
 
-		signalPeerConnections()
+		room.signalPeerConnections()
 
-		message := &websocketMessage{}
-		for {
-			_, raw, err := c.ReadMessage()
-			if err != nil {
-				log.Printf("Failed to read message: %v", err)
+		client.peerConnection = peerConnection
 
+		for raw := range incoming {
+			if !client.process(raw, client.handle) {
 				return
 			}
+		}
+	}
+}
 
-			log.Printf("Got message: %s", raw)
+// readMessages reads the WebSocket in the background until it fails or done
+// is closed. The returned channel is closed when reading stops.
+func readMessages(c *threadSafeWriter, done <-chan struct{}) <-chan []byte {
+	incoming := make(chan []byte)
 
-			if err := json.Unmarshal(raw, &message); err != nil {
-				log.Printf("Failed to unmarshal json to message: %v", err)
+	go func() {
+		defer close(incoming)
+
+		for {
+			_, raw, err := c.ReadMessage()
+			if err != nil {
+				logging.Infof("Failed to read message: %v", err)
 
 				return
 			}
 
-			switch message.Event {
-			case "candidate":
-				candidate := webrtc.ICECandidateInit{}
-				if err := json.Unmarshal([]byte(message.Data), &candidate); err != nil {
-					log.Printf("Failed to unmarshal json to candidate: %v", err)
-
-					return
-				}
-
-				log.Printf("Got candidate: %v", candidate)
-
-				if err := peerConnection.AddICECandidate(candidate); err != nil {
-					log.Printf("Failed to add ICE candidate: %v", err)
-
-					return
-				}
-			case "answer":
-				answer := webrtc.SessionDescription{}
-				if err := json.Unmarshal([]byte(message.Data), &answer); err != nil {
-					log.Printf("Failed to unmarshal json to answer: %v", err)
-
-					return
-				}
-
-				log.Printf("Got answer: %v", answer)
-
-				if err := peerConnection.SetRemoteDescription(answer); err != nil {
-					log.Printf("Failed to set remote description: %v", err)
-
-					return
-				}
-			default:
-				log.Printf("unknown message: %+v", message)
+			select {
+			case incoming <- raw:
+			case <-done:
+				return
 			}
 		}
-	}
+	}()
+
+	return incoming
 }
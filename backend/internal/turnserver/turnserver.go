@@ -0,0 +1,170 @@
+package turnserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/ice"
+	"github.com/Coderovshik/meet/internal/logging"
+
+	"github.com/pion/turn/v4"
+)
+
+// authTimeout ограничивает время проверки сессии пользователя в Redis
+const authTimeout = 2 * time.Second
+
+// Config описывает встроенный TURN/STUN сервер
+type Config struct {
+	Enabled       bool   `yaml:"enabled"`
+	Realm         string `yaml:"realm"`
+	PublicIP      string `yaml:"public_ip"`
+	ListenAddress string `yaml:"listen_address"`
+	UDPPort       int    `yaml:"udp_port"`
+	TCPPort       int    `yaml:"tcp_port"`
+	RelayMinPort  uint16 `yaml:"relay_min_port"`
+	RelayMaxPort  uint16 `yaml:"relay_max_port"`
+}
+
+// DefaultConfig возвращает конфигурацию выключенного сервера со стандартными портами
+func DefaultConfig() Config {
+	return Config{
+		Realm:         "meet",
+		ListenAddress: "0.0.0.0",
+		UDPPort:       3478,
+		TCPPort:       3478,
+		RelayMinPort:  49152,
+		RelayMaxPort:  49252,
+	}
+}
+
+// Validate проверяет конфигурацию включенного сервера
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if net.ParseIP(c.PublicIP) == nil {
+		return errors.New("turn: public_ip must be a valid IP address")
+	}
+	if c.Realm == "" {
+		return errors.New("turn: realm is required")
+	}
+	if c.UDPPort == 0 && c.TCPPort == 0 {
+		return errors.New("turn: at least one of udp_port and tcp_port is required")
+	}
+	if c.UDPPort < 0 || c.UDPPort > 65535 || c.TCPPort < 0 || c.TCPPort > 65535 {
+		return errors.New("turn: invalid listener port")
+	}
+	if c.RelayMinPort == 0 || c.RelayMinPort > c.RelayMaxPort {
+		return errors.New("turn: invalid relay port range")
+	}
+	return nil
+}
+
+// URLs возвращает адреса сервера, которые отдаются клиентам
+func (c Config) URLs() (stunURLs, turnURLs []string) {
+	host := net.JoinHostPort(c.PublicIP, strconv.Itoa(c.UDPPort))
+	if c.UDPPort != 0 {
+		stunURLs = append(stunURLs, "stun:"+host)
+		turnURLs = append(turnURLs, "turn:"+host+"?transport=udp")
+	}
+	if c.TCPPort != 0 {
+		turnURLs = append(turnURLs, "turn:"+net.JoinHostPort(c.PublicIP, strconv.Itoa(c.TCPPort))+"?transport=tcp")
+	}
+	return stunURLs, turnURLs
+}
+
+// Start запускает TURN-сервер. Клиенты аутентифицируются временными учетными
+// данными TURN REST API, подписанными secret, и только пока у пользователя
+// есть активная сессия в SessionStore
+func Start(cfg Config, secret string, sessions *auth.SessionStore) (*turn.Server, error) {
+	if secret == "" {
+		return nil, errors.New("turn: shared secret is required")
+	}
+
+	newRelayGenerator := func() turn.RelayAddressGenerator {
+		return &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: net.ParseIP(cfg.PublicIP),
+			Address:      cfg.ListenAddress,
+			MinPort:      cfg.RelayMinPort,
+			MaxPort:      cfg.RelayMaxPort,
+		}
+	}
+
+	serverConfig := turn.ServerConfig{
+		Realm:       cfg.Realm,
+		AuthHandler: authHandler(secret, sessions),
+	}
+
+	if cfg.UDPPort != 0 {
+		udpListener, err := net.ListenPacket("udp4", net.JoinHostPort(cfg.ListenAddress, strconv.Itoa(cfg.UDPPort)))
+		if err != nil {
+			return nil, fmt.Errorf("turn: listen udp: %w", err)
+		}
+		serverConfig.PacketConnConfigs = append(serverConfig.PacketConnConfigs, turn.PacketConnConfig{
+			PacketConn:            udpListener,
+			RelayAddressGenerator: newRelayGenerator(),
+		})
+	}
+	if cfg.TCPPort != 0 {
+		tcpListener, err := net.Listen("tcp4", net.JoinHostPort(cfg.ListenAddress, strconv.Itoa(cfg.TCPPort)))
+		if err != nil {
+			closeConfigured(serverConfig)
+			return nil, fmt.Errorf("turn: listen tcp: %w", err)
+		}
+		serverConfig.ListenerConfigs = append(serverConfig.ListenerConfigs, turn.ListenerConfig{
+			Listener:              tcpListener,
+			RelayAddressGenerator: newRelayGenerator(),
+		})
+	}
+
+	server, err := turn.NewServer(serverConfig)
+	if err != nil {
+		closeConfigured(serverConfig)
+		return nil, err
+	}
+
+	return server, nil
+}
+
+func authHandler(secret string, sessions *auth.SessionStore) turn.AuthHandler {
+	return func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+		expiry, user, ok := strings.Cut(username, ":")
+		if !ok {
+			return nil, false
+		}
+		expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+		if err != nil || expiresAt < time.Now().Unix() {
+			return nil, false
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), authTimeout)
+		defer cancel()
+
+		active, err := sessions.HasActiveSession(ctx, user)
+		if err != nil {
+			logging.Errorf("TURN: failed to check sessions of %s: %v", user, err)
+			return nil, false
+		}
+		if !active {
+			logging.Warnf("TURN: rejected %s from %s: no active session", user, srcAddr)
+			return nil, false
+		}
+
+		return turn.GenerateAuthKey(username, realm, ice.TURNPassword(secret, username)), true
+	}
+}
+
+func closeConfigured(cfg turn.ServerConfig) {
+	for _, c := range cfg.PacketConnConfigs {
+		c.PacketConn.Close()
+	}
+	for _, c := range cfg.ListenerConfigs {
+		c.Listener.Close()
+	}
+}
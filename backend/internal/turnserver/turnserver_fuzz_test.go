@@ -0,0 +1,55 @@
+package turnserver
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Coderovshik/meet/internal/auth"
+	"github.com/Coderovshik/meet/internal/ice"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pion/turn/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// FuzzAuthHandler проверяет аутентификацию TURN-клиентов с различными именами пользователей
+func FuzzAuthHandler(f *testing.F) {
+	// Добавляем начальные корпусы для фаззера
+	f.Add("user1", int64(3600))
+	f.Add("user1", int64(-3600)) // Истекшие учетные данные
+	f.Add("user2", int64(3600))  // Пользователь без сессии
+	f.Add("", int64(3600))
+	f.Add("user:1", int64(3600))
+
+	f.Fuzz(func(t *testing.T, user string, ttlSeconds int64) {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatalf("Ошибка при запуске miniredis: %v", err)
+		}
+		defer mr.Close()
+
+		sessions := auth.NewSessionStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), auth.DefaultSessionTTL)
+		if _, _, err := sessions.CreateSession(context.Background(), "user1", "127.0.0.1", "fuzz"); err != nil {
+			t.Fatalf("Не удалось создать сессию: %v", err)
+		}
+
+		const secret = "s3cr3t"
+		expiresAt := time.Now().Add(time.Duration(ttlSeconds%(365*24*3600)) * time.Second).Unix()
+		username := strconv.FormatInt(expiresAt, 10) + ":" + user
+		srcAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5000}
+
+		key, ok := authHandler(secret, sessions)(username, "meet", srcAddr)
+
+		// Доступ разрешается только пользователю с активной сессией и неистекшими учетными данными
+		wantOK := user == "user1" && expiresAt >= time.Now().Unix()
+		if ok != wantOK {
+			t.Fatalf("authHandler(%q) = %v, ожидалось %v", username, ok, wantOK)
+		}
+		if ok && !bytes.Equal(key, turn.GenerateAuthKey(username, "meet", ice.TURNPassword(secret, username))) {
+			t.Errorf("Ключ не соответствует паролю TURN REST API")
+		}
+	})
+}
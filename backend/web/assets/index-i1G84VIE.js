@@ -64,4 +64,4 @@ Error generating stack: `+o.message+`
  * LICENSE.md file in the root directory of this source tree.
  *
  * @license MIT
- */function ni(){return ni=Object.assign?Object.assign.bind():function(e){for(var t=1;t<arguments.length;t++){var n=arguments[t];for(var r in n)Object.prototype.hasOwnProperty.call(n,r)&&(e[r]=n[r])}return e},ni.apply(this,arguments)}function dh(e,t){if(e==null)return{};var n={},r=Object.keys(e),l,o;for(o=0;o<r.length;o++)l=r[o],!(t.indexOf(l)>=0)&&(n[l]=e[l]);return n}function ph(e){return!!(e.metaKey||e.altKey||e.ctrlKey||e.shiftKey)}function hh(e,t){return e.button===0&&(!t||t==="_self")&&!ph(e)}const mh=["onClick","relative","reloadDocument","replace","state","target","to","preventScrollReset","viewTransition"],vh="6";try{window.__reactRouterVersion=vh}catch{}const gh="startTransition",gs=af[gh];function yh(e){let{basename:t,children:n,future:r,window:l}=e,o=x.useRef();o.current==null&&(o.current=kp({window:l,v5Compat:!0}));let i=o.current,[u,s]=x.useState({action:i.action,location:i.location}),{v7_startTransition:a}=r||{},h=x.useCallback(d=>{a&&gs?gs(()=>s(d)):s(d)},[s,a]);return x.useLayoutEffect(()=>i.listen(h),[i,h]),x.useEffect(()=>ah(r),[r]),x.createElement(ch,{basename:t,children:n,location:u.location,navigationType:u.action,navigator:i,future:r})}const wh=typeof window<"u"&&typeof window.document<"u"&&typeof window.document.createElement<"u",Sh=/^(?:[a-z][a-z0-9+.-]*:|\/\/)/i,An=x.forwardRef(function(t,n){let{onClick:r,relative:l,reloadDocument:o,replace:i,state:u,target:s,to:a,preventScrollReset:h,viewTransition:d}=t,m=dh(t,mh),{basename:S}=x.useContext(wt),w,v=!1;if(typeof a=="string"&&Sh.test(a)&&(w=a,wh))try{let p=new URL(window.location.href),g=a.startsWith("//")?new URL(p.protocol+a):new URL(a),C=Zi(g.pathname,S);g.origin===p.origin&&C!=null?a=C+g.search+g.hash:v=!0}catch{}let k=Xp(a,{relative:l}),f=kh(a,{replace:i,state:u,target:s,preventScrollReset:h,relative:l,viewTransition:d});function c(p){r&&r(p),p.defaultPrevented||f(p)}return x.createElement("a",ni({},m,{href:w||k,onClick:v||o?r:c,ref:n,target:s}))});var ys;(function(e){e.UseScrollRestoration="useScrollRestoration",e.UseSubmit="useSubmit",e.UseSubmitFetcher="useSubmitFetcher",e.UseFetcher="useFetcher",e.useViewTransitionState="useViewTransitionState"})(ys||(ys={}));var ws;(function(e){e.UseFetcher="useFetcher",e.UseFetchers="useFetchers",e.UseScrollRestoration="useScrollRestoration"})(ws||(ws={}));function kh(e,t){let{target:n,replace:r,state:l,preventScrollReset:o,relative:i,viewTransition:u}=t===void 0?{}:t,s=tu(),a=gn(),h=$c(e,{relative:i});return x.useCallback(d=>{if(hh(d,n)){d.preventDefault();let m=r!==void 0?r:pl(a)===pl(h);s(e,{replace:m,state:l,preventScrollReset:o,relative:i,viewTransition:u})}},[a,s,h,r,l,n,e,o,i,u])}const xh=({onLogin:e})=>{const[t,n]=x.useState(""),[r,l]=x.useState(""),[o,i]=x.useState(""),[u,s]=x.useState(!1),a=async h=>{h.preventDefault(),i(""),s(!0);try{const d=await fetch("/api/login",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({username:t,password:r})});if(d.status!==200){const m=await d.text();i(m||"Ошибка входа. Проверьте имя пользователя и пароль."),s(!1);return}localStorage.setItem("username",t),localStorage.setItem("password",r),e(t,r)}catch(d){i("Произошла ошибка при входе. Пожалуйста, попробуйте позже."),console.error("Login error:",d)}finally{s(!1)}};return y.jsx("div",{className:"auth-container",children:y.jsxs("div",{className:"auth-card",children:[y.jsx("h2",{children:"Вход в систему"}),y.jsxs("form",{onSubmit:a,className:"auth-form",children:[y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"username",children:"Имя пользователя"}),y.jsx("input",{id:"username",type:"text",value:t,onChange:h=>n(h.target.value),placeholder:"Введите имя пользователя",required:!0})]}),y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"password",children:"Пароль"}),y.jsx("input",{id:"password",type:"password",value:r,onChange:h=>l(h.target.value),placeholder:"Введите пароль",required:!0})]}),o&&y.jsx("div",{className:"error-message",children:o}),y.jsx("button",{type:"submit",className:"auth-button",disabled:u,children:u?"Вход...":"Войти"})]}),y.jsx("div",{className:"auth-links",children:y.jsxs("p",{children:["Нет аккаунта? ",y.jsx(An,{to:"/register",children:"Зарегистрироваться"})]})})]})})},Eh=()=>{const[e,t]=x.useState(""),[n,r]=x.useState(""),[l,o]=x.useState(""),[i,u]=x.useState(""),[s,a]=x.useState(!1),[h,d]=x.useState(!1),m=tu(),S=async w=>{if(w.preventDefault(),u(""),a(!0),n!==l){u("Пароли не совпадают"),a(!1);return}try{const v=await fetch("/api/register",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({username:e,password:n})});if(v.status!==201){const k=await v.text();u(k||"Ошибка при регистрации. Попробуйте другое имя пользователя."),a(!1);return}d(!0),setTimeout(()=>{m("/login")},2e3)}catch(v){u("Произошла ошибка при регистрации. Пожалуйста, попробуйте позже."),console.error("Registration error:",v)}finally{a(!1)}};return y.jsx("div",{className:"auth-container",children:y.jsxs("div",{className:"auth-card",children:[y.jsx("h2",{children:"Регистрация"}),h?y.jsx("div",{className:"success-message",children:y.jsx("p",{children:"Регистрация прошла успешно! Сейчас вы будете перенаправлены на страницу входа."})}):y.jsxs("form",{onSubmit:S,className:"auth-form",children:[y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"username",children:"Имя пользователя"}),y.jsx("input",{id:"username",type:"text",value:e,onChange:w=>t(w.target.value),placeholder:"4-32 символа, только латинские буквы и цифры",minLength:4,maxLength:32,pattern:"[a-zA-Z0-9]{4,32}",title:"Имя пользователя должно содержать от 4 до 32 латинских букв или цифр",required:!0})]}),y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"password",children:"Пароль"}),y.jsx("input",{id:"password",type:"password",value:n,onChange:w=>r(w.target.value),placeholder:"Минимум 4 символа",minLength:4,maxLength:32,required:!0})]}),y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"confirmPassword",children:"Подтверждение пароля"}),y.jsx("input",{id:"confirmPassword",type:"password",value:l,onChange:w=>o(w.target.value),placeholder:"Повторите пароль",minLength:4,maxLength:32,required:!0})]}),i&&y.jsx("div",{className:"error-message",children:i}),y.jsx("button",{type:"submit",className:"auth-button",disabled:s,children:s?"Регистрация...":"Зарегистрироваться"})]}),y.jsx("div",{className:"auth-links",children:y.jsxs("p",{children:["Уже есть аккаунт? ",y.jsx(An,{to:"/login",children:"Войти"})]})})]})})},Ch=({username:e,password:t})=>{const n=x.useRef(null),r=x.useRef(null),[l,o]=x.useState(null),[i,u]=x.useState("disconnected"),[s,a]=x.useState(!0),[h,d]=x.useState(!0),[m,S]=x.useState(0);x.useEffect(()=>{let k,f;return(async()=>{try{u("connecting");const p=await navigator.mediaDevices.getUserMedia({video:!0,audio:!0});o(p),n.current&&(n.current.srcObject=p),k=new RTCPeerConnection({iceServers:[{urls:"stun:stun.l.google.com:19302"},{urls:"stun:stun1.l.google.com:19302"}]}),k.ontrack=g=>{var L,$;if(g.track.kind==="audio")return;S(R=>R+1);const C=document.createElement("video");C.srcObject=g.streams[0],C.autoplay=!0,C.playsInline=!0,C.className="remote-video";const N=document.createElement("div");N.className="participant-container";const P=document.createElement("div");P.className="participant-name",P.textContent="Участник "+(((L=r.current)==null?void 0:L.childElementCount)+1),N.appendChild(C),N.appendChild(P),($=r.current)==null||$.appendChild(N),g.track.onmute=()=>{C.play()},g.streams[0].onremovetrack=({track:R})=>{R.kind==="video"&&N.parentNode&&(N.parentNode.removeChild(N),S(ve=>Math.max(0,ve-1)))}},p.getTracks().forEach(g=>k.addTrack(g,p)),f=new WebSocket(`/ws?username=${encodeURIComponent(e)}&password=${encodeURIComponent(t)}`),k.onicecandidate=g=>{g.candidate&&f.send(JSON.stringify({event:"candidate",data:JSON.stringify(g.candidate)}))},f.onopen=()=>{u("connected")},f.onclose=()=>{u("disconnected"),console.log("WebSocket connection closed")},f.onerror=g=>{u("error"),console.error("WebSocket error:",g)},f.onmessage=g=>{const C=JSON.parse(g.data);if(!C)return console.log("Failed to parse message");switch(C.event){case"offer":const N=JSON.parse(C.data);if(!N)return console.log("Failed to parse offer");k.setRemoteDescription(N),k.createAnswer().then(L=>{k.setLocalDescription(L),f.send(JSON.stringify({event:"answer",data:JSON.stringify(L)}))});break;case"candidate":const P=JSON.parse(C.data);if(!P)return console.log("Failed to parse candidate");k.addIceCandidate(P);break;default:break}}}catch(p){u("error"),console.error("Error initializing video call:",p)}})(),()=>{l&&l.getTracks().forEach(p=>p.stop()),f&&f.close(),k&&k.close(),u("disconnected")}},[e,t]);const w=()=>{if(l){const k=l.getAudioTracks()[0];k&&(k.enabled=!k.enabled,a(k.enabled))}},v=()=>{if(l){const k=l.getVideoTracks()[0];k&&(k.enabled=!k.enabled,d(k.enabled))}};return y.jsxs("div",{className:"room-container",children:[y.jsxs("div",{className:"room-header",children:[y.jsx("h2",{children:"Видеоконференция"}),y.jsx("div",{className:`connection-status status-${i}`,children:i==="connected"?"Подключено":i==="connecting"?"Подключение...":i==="error"?"Ошибка подключения":"Отключено"}),y.jsx("div",{className:"participants-info",children:y.jsxs("span",{children:["Участников: ",m+1]})})]}),y.jsxs("div",{className:"video-grid",children:[y.jsxs("div",{className:"local-video-container",children:[y.jsx("video",{ref:n,autoPlay:!0,muted:!0,playsInline:!0,className:`local-video ${h?"":"video-disabled"}`}),y.jsx("div",{className:"local-user-info",children:y.jsxs("span",{children:[e," (Вы)"]})}),y.jsxs("div",{className:"video-controls",children:[y.jsx("button",{className:`control-button ${s?"":"disabled"}`,onClick:w,children:s?"🎤":"🔇"}),y.jsx("button",{className:`control-button ${h?"":"disabled"}`,onClick:v,children:h?"📹":"📵"})]})]}),y.jsx("div",{className:"remote-videos-container",ref:r})]}),y.jsxs("div",{className:"room-info",children:[y.jsx("h3",{children:"Информация о конференции"}),y.jsx("p",{children:"Вы находитесь в общей конференции. Все участники, подключенные к системе, будут видеть и слышать вас."}),y.jsx("p",{children:"Используйте кнопки под вашим видео для управления микрофоном и камерой."})]})]})},Nh=({username:e,password:t})=>{const[n,r]=x.useState([]),[l,o]=x.useState(!0),[i,u]=x.useState(""),[s,a]=x.useState(50);x.useEffect(()=>{h()},[s]);const h=async()=>{o(!0),u("");try{const v=await fetch(`/api/logs?limit=${s}`,{headers:{Authorization:`Basic ${e}:${t}`}});if(!v.ok)throw new Error(`Ошибка: ${v.status} ${v.statusText}`);const k=await v.json();r(k)}catch(v){console.error("Ошибка при получении логов:",v),u("Не удалось загрузить логи. Пожалуйста, попробуйте позже.")}finally{o(!1)}},d=v=>{const k=new Date(v);return new Intl.DateTimeFormat("ru-RU",{day:"2-digit",month:"2-digit",year:"numeric",hour:"2-digit",minute:"2-digit",second:"2-digit"}).format(k)},m=v=>({registration:"Регистрация",login:"Вход в систему",login_failed:"Неудачная попытка входа",room_connection:"Подключение к комнате",room_disconnection:"Отключение от комнаты",room_connection_failed:"Неудачная попытка подключения к комнате",add_track:"Добавление аудио/видео потока"})[v]||v,S=v=>v.includes("failed")?"action-failed":v==="login"||v==="registration"?"action-auth":v.includes("room")?"action-room":v.includes("track")?"action-track":"",w=()=>{h()};return y.jsxs("div",{className:"logs-container",children:[y.jsxs("div",{className:"logs-header",children:[y.jsx("h2",{children:"Логи активности пользователя"}),y.jsxs("div",{className:"logs-controls",children:[y.jsxs("div",{className:"limit-control",children:[y.jsx("label",{htmlFor:"limit",children:"Показать записей:"}),y.jsxs("select",{id:"limit",value:s,onChange:v=>a(Number(v.target.value)),children:[y.jsx("option",{value:10,children:"10"}),y.jsx("option",{value:20,children:"20"}),y.jsx("option",{value:50,children:"50"}),y.jsx("option",{value:100,children:"100"})]})]}),y.jsx("button",{className:"refresh-button",onClick:w,disabled:l,children:l?"Загрузка...":"Обновить"})]})]}),i&&y.jsx("div",{className:"logs-error",children:i}),l?y.jsx("div",{className:"logs-loading",children:"Загрузка логов..."}):n.length===0?y.jsx("div",{className:"logs-empty",children:"Нет доступных логов"}):y.jsx("div",{className:"logs-table-container",children:y.jsxs("table",{className:"logs-table",children:[y.jsx("thead",{children:y.jsxs("tr",{children:[y.jsx("th",{children:"Дата и время"}),y.jsx("th",{children:"Действие"}),y.jsx("th",{children:"Детали"})]})}),y.jsx("tbody",{children:n.map((v,k)=>y.jsxs("tr",{className:S(v.action),children:[y.jsx("td",{className:"timestamp",children:d(v.timestamp)}),y.jsx("td",{className:"action",children:m(v.action)}),y.jsx("td",{className:"details",children:v.details})]},k))})]})})]})},_h=({username:e,onLogout:t})=>{const n=gn();return y.jsxs("nav",{className:"navbar",children:[y.jsx("div",{className:"navbar-logo",children:y.jsx(An,{to:"/room",children:"Meet"})}),y.jsx("div",{className:"navbar-user",children:y.jsx("span",{className:"username",children:e})}),y.jsxs("div",{className:"navbar-menu",children:[y.jsx(An,{to:"/room",className:n.pathname==="/room"?"active":"",children:"Видеоконференция"}),y.jsx(An,{to:"/logs",className:n.pathname==="/logs"?"active":"",children:"Логи"}),y.jsx("button",{className:"logout-button",onClick:t,children:"Выход"})]})]})};function Ph(){const[e,t]=x.useState(localStorage.getItem("username")||""),[n,r]=x.useState(localStorage.getItem("password")||""),[l,o]=x.useState(!1),[i,u]=x.useState(!0);x.useEffect(()=>{(async()=>{if(e&&n)try{const d=await fetch("/api/login",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({username:e,password:n})});o(d.status===200)}catch(d){console.error("Auth check error:",d),o(!1)}else o(!1);u(!1)})()},[e,n]);const s=(h,d)=>{t(h),r(d),o(!0)},a=()=>{localStorage.removeItem("username"),localStorage.removeItem("password"),t(""),r(""),o(!1)};return i?y.jsxs("div",{className:"loading-container",children:[y.jsx("div",{className:"loading-spinner"}),y.jsx("p",{children:"Загрузка..."})]}):y.jsx(yh,{children:y.jsxs("div",{className:"app-container",children:[l&&y.jsx(_h,{username:e,onLogout:a}),y.jsx("main",{className:"main-content",children:y.jsxs(fh,{children:[y.jsx($t,{path:"/login",element:l?y.jsx(Ut,{to:"/room",replace:!0}):y.jsx(xh,{onLogin:s})}),y.jsx($t,{path:"/register",element:l?y.jsx(Ut,{to:"/room",replace:!0}):y.jsx(Eh,{})}),y.jsx($t,{path:"/room",element:l?y.jsx(Ch,{username:e,password:n}):y.jsx(Ut,{to:"/login",replace:!0})}),y.jsx($t,{path:"/logs",element:l?y.jsx(Nh,{username:e,password:n}):y.jsx(Ut,{to:"/login",replace:!0})}),y.jsx($t,{path:"*",element:l?y.jsx(Ut,{to:"/room",replace:!0}):y.jsx(Ut,{to:"/login",replace:!0})})]})}),y.jsx("footer",{className:"app-footer",children:y.jsxs("p",{children:["© ",new Date().getFullYear()," Meet - Сервис видеоконференций"]})})]})})}zc(document.getElementById("root")).render(y.jsx(x.StrictMode,{children:y.jsx(Ph,{})}));
+ */function ni(){return ni=Object.assign?Object.assign.bind():function(e){for(var t=1;t<arguments.length;t++){var n=arguments[t];for(var r in n)Object.prototype.hasOwnProperty.call(n,r)&&(e[r]=n[r])}return e},ni.apply(this,arguments)}function dh(e,t){if(e==null)return{};var n={},r=Object.keys(e),l,o;for(o=0;o<r.length;o++)l=r[o],!(t.indexOf(l)>=0)&&(n[l]=e[l]);return n}function ph(e){return!!(e.metaKey||e.altKey||e.ctrlKey||e.shiftKey)}function hh(e,t){return e.button===0&&(!t||t==="_self")&&!ph(e)}const mh=["onClick","relative","reloadDocument","replace","state","target","to","preventScrollReset","viewTransition"],vh="6";try{window.__reactRouterVersion=vh}catch{}const gh="startTransition",gs=af[gh];function yh(e){let{basename:t,children:n,future:r,window:l}=e,o=x.useRef();o.current==null&&(o.current=kp({window:l,v5Compat:!0}));let i=o.current,[u,s]=x.useState({action:i.action,location:i.location}),{v7_startTransition:a}=r||{},h=x.useCallback(d=>{a&&gs?gs(()=>s(d)):s(d)},[s,a]);return x.useLayoutEffect(()=>i.listen(h),[i,h]),x.useEffect(()=>ah(r),[r]),x.createElement(ch,{basename:t,children:n,location:u.location,navigationType:u.action,navigator:i,future:r})}const wh=typeof window<"u"&&typeof window.document<"u"&&typeof window.document.createElement<"u",Sh=/^(?:[a-z][a-z0-9+.-]*:|\/\/)/i,An=x.forwardRef(function(t,n){let{onClick:r,relative:l,reloadDocument:o,replace:i,state:u,target:s,to:a,preventScrollReset:h,viewTransition:d}=t,m=dh(t,mh),{basename:S}=x.useContext(wt),w,v=!1;if(typeof a=="string"&&Sh.test(a)&&(w=a,wh))try{let p=new URL(window.location.href),g=a.startsWith("//")?new URL(p.protocol+a):new URL(a),C=Zi(g.pathname,S);g.origin===p.origin&&C!=null?a=C+g.search+g.hash:v=!0}catch{}let k=Xp(a,{relative:l}),f=kh(a,{replace:i,state:u,target:s,preventScrollReset:h,relative:l,viewTransition:d});function c(p){r&&r(p),p.defaultPrevented||f(p)}return x.createElement("a",ni({},m,{href:w||k,onClick:v||o?r:c,ref:n,target:s}))});var ys;(function(e){e.UseScrollRestoration="useScrollRestoration",e.UseSubmit="useSubmit",e.UseSubmitFetcher="useSubmitFetcher",e.UseFetcher="useFetcher",e.useViewTransitionState="useViewTransitionState"})(ys||(ys={}));var ws;(function(e){e.UseFetcher="useFetcher",e.UseFetchers="useFetchers",e.UseScrollRestoration="useScrollRestoration"})(ws||(ws={}));function kh(e,t){let{target:n,replace:r,state:l,preventScrollReset:o,relative:i,viewTransition:u}=t===void 0?{}:t,s=tu(),a=gn(),h=$c(e,{relative:i});return x.useCallback(d=>{if(hh(d,n)){d.preventDefault();let m=r!==void 0?r:pl(a)===pl(h);s(e,{replace:m,state:l,preventScrollReset:o,relative:i,viewTransition:u})}},[a,s,h,r,l,n,e,o,i,u])}const xh=({onLogin:e})=>{const[t,n]=x.useState(""),[r,l]=x.useState(""),[o,i]=x.useState(""),[u,s]=x.useState(!1),a=async h=>{h.preventDefault(),i(""),s(!0);try{const d=await fetch("/api/login",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({username:t,password:r})});if(d.status!==200){const m=await d.text();i(m||"Ошибка входа. Проверьте имя пользователя и пароль."),s(!1);return}const{token:m}=await d.json();localStorage.setItem("username",t),localStorage.setItem("token",m),e(t,m)}catch(d){i("Произошла ошибка при входе. Пожалуйста, попробуйте позже."),console.error("Login error:",d)}finally{s(!1)}};return y.jsx("div",{className:"auth-container",children:y.jsxs("div",{className:"auth-card",children:[y.jsx("h2",{children:"Вход в систему"}),y.jsxs("form",{onSubmit:a,className:"auth-form",children:[y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"username",children:"Имя пользователя"}),y.jsx("input",{id:"username",type:"text",value:t,onChange:h=>n(h.target.value),placeholder:"Введите имя пользователя",required:!0})]}),y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"password",children:"Пароль"}),y.jsx("input",{id:"password",type:"password",value:r,onChange:h=>l(h.target.value),placeholder:"Введите пароль",required:!0})]}),o&&y.jsx("div",{className:"error-message",children:o}),y.jsx("button",{type:"submit",className:"auth-button",disabled:u,children:u?"Вход...":"Войти"})]}),y.jsx("div",{className:"auth-links",children:y.jsxs("p",{children:["Нет аккаунта? ",y.jsx(An,{to:"/register",children:"Зарегистрироваться"})]})})]})})},Eh=()=>{const[e,t]=x.useState(""),[n,r]=x.useState(""),[l,o]=x.useState(""),[i,u]=x.useState(""),[s,a]=x.useState(!1),[h,d]=x.useState(!1),m=tu(),S=async w=>{if(w.preventDefault(),u(""),a(!0),n!==l){u("Пароли не совпадают"),a(!1);return}try{const v=await fetch("/api/register",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({username:e,password:n})});if(v.status!==201){const k=await v.text();u(k||"Ошибка при регистрации. Попробуйте другое имя пользователя."),a(!1);return}d(!0),setTimeout(()=>{m("/login")},2e3)}catch(v){u("Произошла ошибка при регистрации. Пожалуйста, попробуйте позже."),console.error("Registration error:",v)}finally{a(!1)}};return y.jsx("div",{className:"auth-container",children:y.jsxs("div",{className:"auth-card",children:[y.jsx("h2",{children:"Регистрация"}),h?y.jsx("div",{className:"success-message",children:y.jsx("p",{children:"Регистрация прошла успешно! Сейчас вы будете перенаправлены на страницу входа."})}):y.jsxs("form",{onSubmit:S,className:"auth-form",children:[y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"username",children:"Имя пользователя"}),y.jsx("input",{id:"username",type:"text",value:e,onChange:w=>t(w.target.value),placeholder:"4-32 символа, только латинские буквы и цифры",minLength:4,maxLength:32,pattern:"[a-zA-Z0-9]{4,32}",title:"Имя пользователя должно содержать от 4 до 32 латинских букв или цифр",required:!0})]}),y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"password",children:"Пароль"}),y.jsx("input",{id:"password",type:"password",value:n,onChange:w=>r(w.target.value),placeholder:"Минимум 4 символа",minLength:4,maxLength:32,required:!0})]}),y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"confirmPassword",children:"Подтверждение пароля"}),y.jsx("input",{id:"confirmPassword",type:"password",value:l,onChange:w=>o(w.target.value),placeholder:"Повторите пароль",minLength:4,maxLength:32,required:!0})]}),i&&y.jsx("div",{className:"error-message",children:i}),y.jsx("button",{type:"submit",className:"auth-button",disabled:s,children:s?"Регистрация...":"Зарегистрироваться"})]}),y.jsx("div",{className:"auth-links",children:y.jsxs("p",{children:["Уже есть аккаунт? ",y.jsx(An,{to:"/login",children:"Войти"})]})})]})})},Ih=async(e,t)=>{const n=new URLSearchParams(window.location.search),r=n.get("room");if(r)return r;const l=await fetch("/api/rooms",{method:"POST",headers:{"Content-Type":"application/json",Authorization:`Bearer ${t}`},body:JSON.stringify({title:`Конференция ${e}`})});if(!l.ok)throw new Error(`Ошибка создания комнаты: ${l.status} ${l.statusText}`);const o=await l.json();return n.set("room",o.id),window.history.replaceState(null,"",`${window.location.pathname}?${n}`),o.id},Ch=({username:e,token:t,invite:J})=>{const n=x.useRef(null),r=x.useRef(null),[l,o]=x.useState(null),[i,u]=x.useState("disconnected"),[s,a]=x.useState(!0),[h,d]=x.useState(!0),[m,S]=x.useState(0);x.useEffect(()=>{let k,f;return(async()=>{try{u("connecting");const c=J?new URLSearchParams(window.location.search).get("room"):await Ih(e,t),p=await navigator.mediaDevices.getUserMedia({video:!0,audio:!0});o(p),n.current&&(n.current.srcObject=p),k=new RTCPeerConnection({iceServers:[{urls:"stun:stun.l.google.com:19302"},{urls:"stun:stun1.l.google.com:19302"}]}),k.ontrack=g=>{var L,$;if(g.track.kind==="audio")return;S(R=>R+1);const C=document.createElement("video");C.srcObject=g.streams[0],C.autoplay=!0,C.playsInline=!0,C.className="remote-video";const N=document.createElement("div");N.className="participant-container";const P=document.createElement("div");P.className="participant-name",P.textContent="Участник "+(((L=r.current)==null?void 0:L.childElementCount)+1),N.appendChild(C),N.appendChild(P),($=r.current)==null||$.appendChild(N),g.track.onmute=()=>{C.play()},g.streams[0].onremovetrack=({track:R})=>{R.kind==="video"&&N.parentNode&&(N.parentNode.removeChild(N),S(ve=>Math.max(0,ve-1)))}},p.getTracks().forEach(g=>k.addTrack(g,p)),f=new WebSocket(`/ws?room=${encodeURIComponent(c)}&${J?`invite=${encodeURIComponent(J)}&name=${encodeURIComponent(e)}`:`token=${encodeURIComponent(t)}`}`),k.onicecandidate=g=>{g.candidate&&f.send(JSON.stringify({event:"candidate",data:JSON.stringify(g.candidate)}))},f.onopen=()=>{u("connected")},f.onclose=()=>{u("disconnected"),console.log("WebSocket connection closed")},f.onerror=g=>{u("error"),console.error("WebSocket error:",g)},f.onmessage=g=>{const C=JSON.parse(g.data);if(!C)return console.log("Failed to parse message");switch(C.event){case"offer":const N=JSON.parse(C.data);if(!N)return console.log("Failed to parse offer");k.setRemoteDescription(N),k.createAnswer().then(L=>{k.setLocalDescription(L),f.send(JSON.stringify({event:"answer",data:JSON.stringify(L)}))});break;case"candidate":const P=JSON.parse(C.data);if(!P)return console.log("Failed to parse candidate");k.addIceCandidate(P);break;default:break}}}catch(p){u("error"),console.error("Error initializing video call:",p)}})(),()=>{l&&l.getTracks().forEach(p=>p.stop()),f&&f.close(),k&&k.close(),u("disconnected")}},[e,t,J]);const w=()=>{if(l){const k=l.getAudioTracks()[0];k&&(k.enabled=!k.enabled,a(k.enabled))}},v=()=>{if(l){const k=l.getVideoTracks()[0];k&&(k.enabled=!k.enabled,d(k.enabled))}};return y.jsxs("div",{className:"room-container",children:[y.jsxs("div",{className:"room-header",children:[y.jsx("h2",{children:"Видеоконференция"}),y.jsx("div",{className:`connection-status status-${i}`,children:i==="connected"?"Подключено":i==="connecting"?"Подключение...":i==="error"?"Ошибка подключения":"Отключено"}),y.jsx("div",{className:"participants-info",children:y.jsxs("span",{children:["Участников: ",m+1]})})]}),y.jsxs("div",{className:"video-grid",children:[y.jsxs("div",{className:"local-video-container",children:[y.jsx("video",{ref:n,autoPlay:!0,muted:!0,playsInline:!0,className:`local-video ${h?"":"video-disabled"}`}),y.jsx("div",{className:"local-user-info",children:y.jsxs("span",{children:[e," (Вы)"]})}),y.jsxs("div",{className:"video-controls",children:[y.jsx("button",{className:`control-button ${s?"":"disabled"}`,onClick:w,children:s?"🎤":"🔇"}),y.jsx("button",{className:`control-button ${h?"":"disabled"}`,onClick:v,children:h?"📹":"📵"})]})]}),y.jsx("div",{className:"remote-videos-container",ref:r})]}),y.jsxs("div",{className:"room-info",children:[y.jsx("h3",{children:"Информация о конференции"}),J?y.jsx("p",{children:"Вы подключились к конференции по приглашению как гость."}):y.jsx("p",{children:"Чтобы пригласить участников, поделитесь ссылкой на эту страницу: все, кто откроет её, попадут в эту же конференцию."}),y.jsx("p",{children:"Используйте кнопки под вашим видео для управления микрофоном и камерой."})]})]})},Jh=()=>{const e=new URLSearchParams(window.location.search),t=e.get("room"),n=e.get("invite"),[r,l]=x.useState(""),[o,i]=x.useState(!1);if(!t||!n)return y.jsx("div",{className:"auth-container",children:y.jsxs("div",{className:"auth-card",children:[y.jsx("h2",{children:"Приглашение"}),y.jsx("div",{className:"error-message",children:"Ссылка приглашения неполная. Попросите организатора прислать её ещё раз."})]})});if(o)return y.jsx(Ch,{username:r.trim(),invite:n});const u=s=>{s.preventDefault(),i(!0)};return y.jsx("div",{className:"auth-container",children:y.jsxs("div",{className:"auth-card",children:[y.jsx("h2",{children:"Присоединиться к конференции"}),y.jsxs("form",{onSubmit:u,className:"auth-form",children:[y.jsxs("div",{className:"form-group",children:[y.jsx("label",{htmlFor:"name",children:"Ваше имя"}),y.jsx("input",{id:"name",type:"text",value:r,onChange:s=>l(s.target.value),placeholder:"Как вас увидят участники",maxLength:32,required:!0})]}),y.jsx("button",{type:"submit",className:"auth-button",disabled:!r.trim(),children:"Присоединиться"})]})]})})},Nh=({token:t})=>{const[n,r]=x.useState([]),[l,o]=x.useState(!0),[i,u]=x.useState(""),[s,a]=x.useState(50);x.useEffect(()=>{h()},[s]);const h=async()=>{o(!0),u("");try{const v=await fetch(`/api/logs?limit=${s}`,{headers:{Authorization:`Bearer ${t}`}});if(!v.ok)throw new Error(`Ошибка: ${v.status} ${v.statusText}`);const k=await v.json();r(k)}catch(v){console.error("Ошибка при получении логов:",v),u("Не удалось загрузить логи. Пожалуйста, попробуйте позже.")}finally{o(!1)}},d=v=>{const k=new Date(v);return new Intl.DateTimeFormat("ru-RU",{day:"2-digit",month:"2-digit",year:"numeric",hour:"2-digit",minute:"2-digit",second:"2-digit"}).format(k)},m=v=>({registration:"Регистрация",login:"Вход в систему",login_failed:"Неудачная попытка входа",room_connection:"Подключение к комнате",room_disconnection:"Отключение от комнаты",room_connection_failed:"Неудачная попытка подключения к комнате",add_track:"Добавление аудио/видео потока"})[v]||v,S=v=>v.includes("failed")?"action-failed":v==="login"||v==="registration"?"action-auth":v.includes("room")?"action-room":v.includes("track")?"action-track":"",w=()=>{h()};return y.jsxs("div",{className:"logs-container",children:[y.jsxs("div",{className:"logs-header",children:[y.jsx("h2",{children:"Логи активности пользователя"}),y.jsxs("div",{className:"logs-controls",children:[y.jsxs("div",{className:"limit-control",children:[y.jsx("label",{htmlFor:"limit",children:"Показать записей:"}),y.jsxs("select",{id:"limit",value:s,onChange:v=>a(Number(v.target.value)),children:[y.jsx("option",{value:10,children:"10"}),y.jsx("option",{value:20,children:"20"}),y.jsx("option",{value:50,children:"50"}),y.jsx("option",{value:100,children:"100"})]})]}),y.jsx("button",{className:"refresh-button",onClick:w,disabled:l,children:l?"Загрузка...":"Обновить"})]})]}),i&&y.jsx("div",{className:"logs-error",children:i}),l?y.jsx("div",{className:"logs-loading",children:"Загрузка логов..."}):n.length===0?y.jsx("div",{className:"logs-empty",children:"Нет доступных логов"}):y.jsx("div",{className:"logs-table-container",children:y.jsxs("table",{className:"logs-table",children:[y.jsx("thead",{children:y.jsxs("tr",{children:[y.jsx("th",{children:"Дата и время"}),y.jsx("th",{children:"Действие"}),y.jsx("th",{children:"Детали"})]})}),y.jsx("tbody",{children:n.map((v,k)=>y.jsxs("tr",{className:S(v.action),children:[y.jsx("td",{className:"timestamp",children:d(v.timestamp)}),y.jsx("td",{className:"action",children:m(v.action)}),y.jsx("td",{className:"details",children:v.details})]},k))})]})})]})},_h=({username:e,onLogout:t})=>{const n=gn();return y.jsxs("nav",{className:"navbar",children:[y.jsx("div",{className:"navbar-logo",children:y.jsx(An,{to:"/room",children:"Meet"})}),y.jsx("div",{className:"navbar-user",children:y.jsx("span",{className:"username",children:e})}),y.jsxs("div",{className:"navbar-menu",children:[y.jsx(An,{to:"/room",className:n.pathname==="/room"?"active":"",children:"Видеоконференция"}),y.jsx(An,{to:"/logs",className:n.pathname==="/logs"?"active":"",children:"Логи"}),y.jsx("button",{className:"logout-button",onClick:t,children:"Выход"})]})]})};function Ph(){const[e,t]=x.useState(localStorage.getItem("username")||""),[c,f]=x.useState(localStorage.getItem("token")||""),[l,o]=x.useState(!1),[i,u]=x.useState(!0),p=()=>{localStorage.removeItem("username"),localStorage.removeItem("token"),t(""),f(""),o(!1)};x.useEffect(()=>{localStorage.removeItem("password"),(async()=>{if(c)try{const d=await fetch("/api/sessions",{headers:{Authorization:`Bearer ${c}`}});d.ok?o(!0):d.status===401?p():o(!1)}catch(d){console.error("Auth check error:",d),o(!1)}else o(!1);u(!1)})()},[]);const s=(h,m)=>{t(h),f(m),o(!0)},a=async()=>{try{await fetch("/api/logout",{method:"POST",headers:{Authorization:`Bearer ${c}`}})}catch(h){console.error("Logout error:",h)}p()};return i?y.jsxs("div",{className:"loading-container",children:[y.jsx("div",{className:"loading-spinner"}),y.jsx("p",{children:"Загрузка..."})]}):y.jsx(yh,{children:y.jsxs("div",{className:"app-container",children:[l&&y.jsx(_h,{username:e,onLogout:a}),y.jsx("main",{className:"main-content",children:y.jsxs(fh,{children:[y.jsx($t,{path:"/login",element:l?y.jsx(Ut,{to:"/room",replace:!0}):y.jsx(xh,{onLogin:s})}),y.jsx($t,{path:"/register",element:l?y.jsx(Ut,{to:"/room",replace:!0}):y.jsx(Eh,{})}),y.jsx($t,{path:"/room",element:l?y.jsx(Ch,{username:e,token:c}):y.jsx(Ut,{to:"/login",replace:!0})}),y.jsx($t,{path:"/join",element:y.jsx(Jh,{})}),y.jsx($t,{path:"/logs",element:l?y.jsx(Nh,{token:c}):y.jsx(Ut,{to:"/login",replace:!0})}),y.jsx($t,{path:"*",element:l?y.jsx(Ut,{to:"/room",replace:!0}):y.jsx(Ut,{to:"/login",replace:!0})})]})}),y.jsx("footer",{className:"app-footer",children:y.jsxs("p",{children:["© ",new Date().getFullYear()," Meet - Сервис видеоконференций"]})})]})})}zc(document.getElementById("root")).render(y.jsx(x.StrictMode,{children:y.jsx(Ph,{})}));
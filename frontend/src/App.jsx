@@ -3,28 +3,44 @@ import { BrowserRouter as Router, Routes, Route, Navigate } from 'react-router-d
 import Login from './components/Login';
 import Register from './components/Register';
 import Room from './components/Room';
+import Join from './components/Join';
 import UserLogs from './components/UserLogs';
 import Navbar from './components/Navbar';
 import './App.css';
 
 function App() {
   const [username, setUsername] = useState(localStorage.getItem('username') || '');
-  const [password, setPassword] = useState(localStorage.getItem('password') || '');
+  const [token, setToken] = useState(localStorage.getItem('token') || '');
   const [isAuthenticated, setIsAuthenticated] = useState(false);
   const [loading, setLoading] = useState(true);
 
+  const clearAuth = () => {
+    localStorage.removeItem('username');
+    localStorage.removeItem('token');
+    setUsername('');
+    setToken('');
+    setIsAuthenticated(false);
+  };
+
   useEffect(() => {
-    // Проверяем аутентификацию при загрузке
+    // Пароль больше не хранится, удаляем оставшийся от старых версий
+    localStorage.removeItem('password');
+
+    // Проверяем сохраненный токен при загрузке, не создавая новую сессию
     const checkAuth = async () => {
-      if (username && password) {
+      if (token) {
         try {
-          const response = await fetch('/api/login', {
-            method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ username, password }),
+          const response = await fetch('/api/sessions', {
+            headers: { 'Authorization': `Bearer ${token}` },
           });
 
-          setIsAuthenticated(response.status === 200);
+          if (response.ok) {
+            setIsAuthenticated(true);
+          } else if (response.status === 401) {
+            clearAuth();
+          } else {
+            setIsAuthenticated(false);
+          }
         } catch (error) {
           console.error('Auth check error:', error);
           setIsAuthenticated(false);
@@ -36,20 +52,25 @@ function App() {
     };
 
     checkAuth();
-  }, [username, password]);
+  }, []);
 
-  const handleLogin = (username, password) => {
+  const handleLogin = (username, token) => {
     setUsername(username);
-    setPassword(password);
+    setToken(token);
     setIsAuthenticated(true);
   };
 
-  const handleLogout = () => {
-    localStorage.removeItem('username');
-    localStorage.removeItem('password');
-    setUsername('');
-    setPassword('');
-    setIsAuthenticated(false);
+  const handleLogout = async () => {
+    // Завершаем сессию на сервере, иначе токен действует до истечения срока
+    try {
+      await fetch('/api/logout', {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${token}` },
+      });
+    } catch (error) {
+      console.error('Logout error:', error);
+    }
+    clearAuth();
   };
 
   if (loading) {
@@ -92,16 +113,21 @@ function App() {
               path="/room" 
               element={
                 isAuthenticated ? 
-                <Room username={username} password={password} /> : 
+                <Room username={username} token={token} /> : 
                 <Navigate to="/login" replace />
               } 
             />
             
+            <Route 
+              path="/join" 
+              element={<Join />} 
+            />
+            
             <Route 
               path="/logs" 
               element={
                 isAuthenticated ? 
-                <UserLogs username={username} password={password} /> : 
+                <UserLogs token={token} /> : 
                 <Navigate to="/login" replace />
               } 
             />
@@ -0,0 +1,61 @@
+import React, { useState } from 'react';
+import Room from './Room';
+import './Auth.css';
+
+// Страница приглашения /join?room=<id>&invite=<токен>: гость вводит имя и
+// подключается к комнате без регистрации.
+const Join = () => {
+  const params = new URLSearchParams(window.location.search);
+  const room = params.get('room');
+  const invite = params.get('invite');
+  const [name, setName] = useState('');
+  const [joined, setJoined] = useState(false);
+
+  if (!room || !invite) {
+    return (
+      <div className="auth-container">
+        <div className="auth-card">
+          <h2>Приглашение</h2>
+          <div className="error-message">Ссылка приглашения неполная. Попросите организатора прислать её ещё раз.</div>
+        </div>
+      </div>
+    );
+  }
+
+  if (joined) {
+    return <Room username={name.trim()} invite={invite} />;
+  }
+
+  const handleJoin = (e) => {
+    e.preventDefault();
+    setJoined(true);
+  };
+
+  return (
+    <div className="auth-container">
+      <div className="auth-card">
+        <h2>Присоединиться к конференции</h2>
+        <form onSubmit={handleJoin} className="auth-form">
+          <div className="form-group">
+            <label htmlFor="name">Ваше имя</label>
+            <input
+              id="name"
+              type="text"
+              value={name}
+              onChange={(e) => setName(e.target.value)}
+              placeholder="Как вас увидят участники"
+              maxLength={32}
+              required
+            />
+          </div>
+
+          <button type="submit" className="auth-button" disabled={!name.trim()}>
+            Присоединиться
+          </button>
+        </form>
+      </div>
+    </div>
+  );
+};
+
+export default Join;
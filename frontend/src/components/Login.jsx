@@ -27,9 +27,10 @@ const Login = ({ onLogin }) => {
         return;
       }
 
+      const { token } = await resp.json();
       localStorage.setItem('username', username);
-      localStorage.setItem('password', password);
-      onLogin(username, password);
+      localStorage.setItem('token', token);
+      onLogin(username, token);
     } catch (err) {
       setError('Произошла ошибка при входе. Пожалуйста, попробуйте позже.');
       console.error('Login error:', err);
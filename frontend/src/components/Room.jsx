@@ -1,7 +1,34 @@
 import React, { useEffect, useRef, useState } from 'react';
 import './Room.css';
 
-const Room = ({ username, password }) => {
+// Комната берётся из ?room= в адресе; если её нет, создаём новую и
+// записываем её идентификатор в адрес, чтобы ссылкой можно было поделиться.
+const resolveRoomId = async (username, token) => {
+    const params = new URLSearchParams(window.location.search);
+    const existing = params.get('room');
+    if (existing) return existing;
+
+    const response = await fetch('/api/rooms', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'Authorization': `Bearer ${token}`
+        },
+        body: JSON.stringify({ title: `Конференция ${username}` })
+    });
+    if (!response.ok) {
+        throw new Error(`Ошибка создания комнаты: ${response.status} ${response.statusText}`);
+    }
+
+    const room = await response.json();
+    params.set('room', room.id);
+    window.history.replaceState(null, '', `${window.location.pathname}?${params}`);
+    return room.id;
+};
+
+// Гость (invite задан) подключается по приглашению к комнате из адреса под
+// введённым именем, зарегистрированный пользователь - по токену сессии.
+const Room = ({ username, token, invite }) => {
     const localVideoRef = useRef(null);
     const remoteVideosRef = useRef(null);
     const [localStream, setLocalStream] = useState(null);
@@ -17,6 +44,9 @@ const Room = ({ username, password }) => {
         const init = async () => {
             try {
                 setConnectionStatus('connecting');
+                const roomId = invite
+                    ? new URLSearchParams(window.location.search).get('room')
+                    : await resolveRoomId(username, token);
                 const stream = await navigator.mediaDevices.getUserMedia({ video: true, audio: true });
                 setLocalStream(stream);
                 
@@ -68,7 +98,10 @@ const Room = ({ username, password }) => {
 
                 stream.getTracks().forEach(track => pc.addTrack(track, stream));
 
-                ws = new WebSocket(`/ws?username=${encodeURIComponent(username)}&password=${encodeURIComponent(password)}`);
+                const credentials = invite
+                    ? `invite=${encodeURIComponent(invite)}&name=${encodeURIComponent(username)}`
+                    : `token=${encodeURIComponent(token)}`;
+                ws = new WebSocket(`/ws?room=${encodeURIComponent(roomId)}&${credentials}`);
 
                 pc.onicecandidate = e => {
                     if (e.candidate) {
@@ -131,7 +164,7 @@ const Room = ({ username, password }) => {
             if (pc) pc.close();
             setConnectionStatus('disconnected');
         };
-    }, [username, password]);
+    }, [username, token, invite]);
 
     const toggleAudio = () => {
         if (localStream) {
@@ -200,7 +233,11 @@ const Room = ({ username, password }) => {
             
             <div className="room-info">
                 <h3>Информация о конференции</h3>
-                <p>Вы находитесь в общей конференции. Все участники, подключенные к системе, будут видеть и слышать вас.</p>
+                {invite ? (
+                    <p>Вы подключились к конференции по приглашению как гость.</p>
+                ) : (
+                    <p>Чтобы пригласить участников, поделитесь ссылкой на эту страницу: все, кто откроет её, попадут в эту же конференцию.</p>
+                )}
                 <p>Используйте кнопки под вашим видео для управления микрофоном и камерой.</p>
             </div>
         </div>
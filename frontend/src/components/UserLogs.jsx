@@ -1,7 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import './UserLogs.css';
 
-const UserLogs = ({ username, password }) => {
+const UserLogs = ({ token }) => {
   const [logs, setLogs] = useState([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
@@ -18,7 +18,7 @@ const UserLogs = ({ username, password }) => {
     try {
       const response = await fetch(`/api/logs?limit=${limit}`, {
         headers: {
-          'Authorization': `Basic ${username}:${password}`
+          'Authorization': `Bearer ${token}`
         }
       });
       